@@ -0,0 +1,402 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/authelia/gox/gox"
+	"gopkg.in/yaml.v3"
+)
+
+// configFileNames are the file names that are searched for in the current
+// directory when no -config flag is given, in order of preference.
+var configFileNames = []string{"gox.toml", "gox.yaml", "gox.yml"}
+
+// Config is the project configuration file. Every value maps one-to-one
+// to the command-line flag of the same name, and any flag given on the
+// command-line takes precedence over the value in the file. Booleans are
+// pointers so that one set to false is told apart from one that isn't set.
+type Config struct {
+	Packages  []string `toml:"packages" yaml:"packages"`
+	OS        []string `toml:"os" yaml:"os"`
+	Arch      []string `toml:"arch" yaml:"arch"`
+	OSArch    []string `toml:"osarch" yaml:"osarch"`
+	Output    string   `toml:"output" yaml:"output"`
+	Parallel  int      `toml:"parallel" yaml:"parallel"`
+	Ldflags   string   `toml:"ldflags" yaml:"ldflags"`
+	Gcflags   string   `toml:"gcflags" yaml:"gcflags"`
+	Asmflags  string   `toml:"asmflags" yaml:"asmflags"`
+	Tags      string   `toml:"tags" yaml:"tags"`
+	ModMode   string   `toml:"mod" yaml:"mod"`
+	Buildmode string   `toml:"buildmode" yaml:"buildmode"`
+	BuildVCS  string   `toml:"buildvcs" yaml:"buildvcs"`
+	GoCmd     string   `toml:"gocmd" yaml:"gocmd"`
+	Cgo       *bool    `toml:"cgo" yaml:"cgo"`
+	Rebuild   *bool    `toml:"rebuild" yaml:"rebuild"`
+	TrimPath  *bool    `toml:"trimpath" yaml:"trimpath"`
+	Race      *bool    `toml:"race" yaml:"race"`
+	Verbose   *bool    `toml:"verbose" yaml:"verbose"`
+	JSON      *bool    `toml:"json" yaml:"json"`
+	FailFast  *bool    `toml:"fail-fast" yaml:"fail-fast"`
+	Timeout   string   `toml:"timeout" yaml:"timeout"`
+	Retries   int      `toml:"retries" yaml:"retries"`
+
+	SkipUnsupported *bool `toml:"skip-unsupported" yaml:"skip-unsupported"`
+	SkipVerify      *bool `toml:"skip-verify" yaml:"skip-verify"`
+
+	CgoToolchain string `toml:"cgo-toolchain" yaml:"cgo-toolchain"`
+	CgoLibc      string `toml:"cgo-libc" yaml:"cgo-libc"`
+
+	Archive       *bool    `toml:"archive" yaml:"archive"`
+	ArchiveFormat []string `toml:"archive-format" yaml:"archive-format"`
+	ArchiveOutput string   `toml:"archive-output" yaml:"archive-output"`
+	ArchiveFiles  []string `toml:"archive-files" yaml:"archive-files"`
+
+	Checksum        string `toml:"checksum" yaml:"checksum"`
+	ChecksumOutput  string `toml:"checksum-output" yaml:"checksum-output"`
+	ChecksumSidecar *bool  `toml:"checksum-sidecar" yaml:"checksum-sidecar"`
+
+	Manifest string `toml:"manifest" yaml:"manifest"`
+	LogDir   string `toml:"log-dir" yaml:"log-dir"`
+
+	SBOM []string `toml:"sbom" yaml:"sbom"`
+
+	MaxSize         string  `toml:"max-size" yaml:"max-size"`
+	CompareManifest string  `toml:"compare-manifest" yaml:"compare-manifest"`
+	MaxGrowth       float64 `toml:"max-growth" yaml:"max-growth"`
+
+	PreHooks  []string `toml:"pre-hooks" yaml:"pre-hooks"`
+	PostHooks []string `toml:"post-hooks" yaml:"post-hooks"`
+
+	// Stamp maps symbols to the git field that is set into them.
+	Stamp map[string]string `toml:"stamp" yaml:"stamp"`
+
+	Universal        *bool `toml:"universal" yaml:"universal"`
+	UniversalReplace *bool `toml:"universal-replace" yaml:"universal-replace"`
+
+	Codesign     *bool  `toml:"codesign" yaml:"codesign"`
+	Entitlements string `toml:"entitlements" yaml:"entitlements"`
+
+	// PackageMaxSize are the size budgets keyed by the import path of
+	// the package.
+	PackageMaxSize map[string]string `toml:"package-max-size" yaml:"package-max-size"`
+
+	// Overrides are keyed by "os", "arch", "os/arch" or "os/arch/variant"
+	// and take the place of the GOX_* environment variables.
+	Overrides map[string]PlatformOverride `toml:"overrides" yaml:"overrides"`
+
+	// WindowsResources are embedded into the binaries for Windows.
+	WindowsResources *WindowsResources `toml:"windows-resources" yaml:"windows-resources"`
+}
+
+// WindowsResources are the resources embedded into Windows binaries, see
+// gox.WindowsResources.
+type WindowsResources struct {
+	Icon        string            `toml:"icon" yaml:"icon"`
+	Manifest    string            `toml:"manifest" yaml:"manifest"`
+	VersionInfo map[string]string `toml:"version-info" yaml:"version-info"`
+}
+
+// PlatformOverride is the set of values that can be overridden for a
+// platform. The keys are those of the GOX_* environment variables, in
+// lowercase and with hyphens like the rest of the config file. Like the
+// environment variables, a string value that starts with "+" is appended
+// to the value it overrides.
+type PlatformOverride struct {
+	Ldflags    string            `toml:"ldflags" yaml:"ldflags"`
+	Gcflags    string            `toml:"gcflags" yaml:"gcflags"`
+	Asmflags   string            `toml:"asmflags" yaml:"asmflags"`
+	Tags       string            `toml:"tags" yaml:"tags"`
+	Buildmode  string            `toml:"buildmode" yaml:"buildmode"`
+	TrimPath   *bool             `toml:"trimpath" yaml:"trimpath"`
+	Output     string            `toml:"output" yaml:"output"`
+	CgoEnabled *bool             `toml:"cgo-enabled" yaml:"cgo-enabled"`
+	CgoCflags  string            `toml:"cgo-cflags" yaml:"cgo-cflags"`
+	CgoLdflags string            `toml:"cgo-ldflags" yaml:"cgo-ldflags"`
+	Cc         string            `toml:"cc" yaml:"cc"`
+	Cxx        string            `toml:"cxx" yaml:"cxx"`
+	MaxSize    string            `toml:"max-size" yaml:"max-size"`
+	Env        map[string]string `toml:"env" yaml:"env"`
+}
+
+// apply applies the override to opts.
+func (o *PlatformOverride) apply(opts *gox.CompileOpts) error {
+	values := map[string]string{
+		"LDFLAGS":     o.Ldflags,
+		"GCFLAGS":     o.Gcflags,
+		"ASMFLAGS":    o.Asmflags,
+		"TAGS":        o.Tags,
+		"BUILDMODE":   o.Buildmode,
+		"OUTPUT":      o.Output,
+		"CGO_CFLAGS":  o.CgoCflags,
+		"CGO_LDFLAGS": o.CgoLdflags,
+		"CC":          o.Cc,
+		"CXX":         o.Cxx,
+		"MAX_SIZE":    o.MaxSize,
+	}
+	if o.TrimPath != nil {
+		values["TRIMPATH"] = strconv.FormatBool(*o.TrimPath)
+	}
+	if o.CgoEnabled != nil {
+		values["CGO_ENABLED"] = strconv.FormatBool(*o.CgoEnabled)
+	}
+
+	for _, key := range gox.OverrideKeys {
+		if v := values[key]; v != "" {
+			if err := gox.ApplyOverride(opts, key, v); err != nil {
+				return err
+			}
+		}
+	}
+
+	names := make([]string, 0, len(o.Env))
+	for name := range o.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		gox.OverrideEnv(opts, name, o.Env[name])
+	}
+
+	return nil
+}
+
+// LoadConfig reads the configuration file at path. If path is empty then
+// the default file names are searched for in the current directory, and
+// a nil Config is returned if none of them exist.
+func LoadConfig(path string) (*Config, error) {
+	if path == "" {
+		for _, name := range configFileNames {
+			if _, err := os.Stat(name); err == nil {
+				path = name
+				break
+			}
+		}
+
+		if path == "" {
+			return nil, nil
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unknown keys are an error, so that a typo doesn't silently leave an
+	// option unset.
+	var config Config
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".toml":
+		md, err := toml.Decode(string(data), &config)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, len(undecoded))
+			for i, key := range undecoded {
+				keys[i] = key.String()
+			}
+			return nil, fmt.Errorf("%s: unknown keys: %s", path, strings.Join(keys, ", "))
+		}
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&config); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("%s: unknown config format %q", path, ext)
+	}
+
+	overrides := make(map[string]PlatformOverride, len(config.Overrides))
+	for key, o := range config.Overrides {
+		if n := strings.Count(key, "/"); n > 2 {
+			return nil, fmt.Errorf(
+				"%s: invalid override %q should be os, arch, os/arch or os/arch/variant", path, key)
+		}
+
+		overrides[strings.ToLower(key)] = o
+	}
+	config.Overrides = overrides
+
+	return &config, nil
+}
+
+// ApplyFlags sets every flag that wasn't given on the command-line to
+// the value from the configuration, so that the command-line always
+// takes precedence.
+func (c *Config) ApplyFlags(flags *flag.FlagSet) error {
+	set := make(map[string]struct{})
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = struct{}{}
+	})
+
+	values := map[string]string{
+		"os":        strings.Join(c.OS, " "),
+		"arch":      strings.Join(c.Arch, " "),
+		"osarch":    strings.Join(c.OSArch, " "),
+		"output":    c.Output,
+		"ldflags":   c.Ldflags,
+		"gcflags":   c.Gcflags,
+		"asmflags":  c.Asmflags,
+		"tags":      c.Tags,
+		"mod":       c.ModMode,
+		"buildmode": c.Buildmode,
+		"buildvcs":  c.BuildVCS,
+		"gocmd":     c.GoCmd,
+
+		"archive-format": strings.Join(c.ArchiveFormat, " "),
+		"archive-output": c.ArchiveOutput,
+		"archive-files":  strings.Join(c.ArchiveFiles, " "),
+
+		"sbom": strings.Join(c.SBOM, " "),
+
+		"checksum":        c.Checksum,
+		"checksum-output": c.ChecksumOutput,
+
+		"entitlements": c.Entitlements,
+
+		"manifest": c.Manifest,
+		"log-dir":  c.LogDir,
+
+		"max-size":         c.MaxSize,
+		"compare-manifest": c.CompareManifest,
+		"timeout":          c.Timeout,
+
+		"cgo-toolchain": c.CgoToolchain,
+		"cgo-libc":      c.CgoLibc,
+	}
+	if c.Parallel > 0 {
+		values["parallel"] = strconv.Itoa(c.Parallel)
+	}
+	if c.Retries > 0 {
+		values["retries"] = strconv.Itoa(c.Retries)
+	}
+	if c.MaxGrowth > 0 {
+		values["max-growth"] = strconv.FormatFloat(c.MaxGrowth, 'f', -1, 64)
+	}
+	for name, v := range map[string]*bool{
+		"cgo":      c.Cgo,
+		"rebuild":  c.Rebuild,
+		"trimpath": c.TrimPath,
+		"race":     c.Race,
+		"verbose":  c.Verbose,
+		"json":     c.JSON,
+
+		"fail-fast": c.FailFast,
+		"archive":   c.Archive,
+
+		"skip-unsupported": c.SkipUnsupported,
+		"skip-verify":      c.SkipVerify,
+
+		"universal":         c.Universal,
+		"universal-replace": c.UniversalReplace,
+		"codesign":          c.Codesign,
+
+		"checksum-sidecar": c.ChecksumSidecar,
+	} {
+		if v != nil {
+			values[name] = strconv.FormatBool(*v)
+		}
+	}
+
+	for name, v := range values {
+		if _, ok := set[name]; ok || v == "" {
+			continue
+		}
+
+		if err := flags.Set(name, v); err != nil {
+			return fmt.Errorf("invalid config value for %s: %s", name, err)
+		}
+	}
+
+	stamp := make([]string, 0, len(c.Stamp))
+	for symbol, field := range c.Stamp {
+		stamp = append(stamp, symbol+"="+field)
+	}
+	sort.Strings(stamp)
+
+	// The flags that can be repeated are set once for each value.
+	for name, list := range map[string][]string{
+		"pre-hook":  c.PreHooks,
+		"post-hook": c.PostHooks,
+		"stamp":     stamp,
+	} {
+		if _, ok := set[name]; ok {
+			continue
+		}
+
+		for _, v := range list {
+			if err := flags.Set(name, v); err != nil {
+				return fmt.Errorf("invalid config value for %s: %s", name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// windowsResources returns the configured Windows resources, or nil if
+// there are none.
+func (c *Config) windowsResources() *gox.WindowsResources {
+	if c == nil || c.WindowsResources == nil {
+		return nil
+	}
+
+	return &gox.WindowsResources{
+		Icon:        c.WindowsResources.Icon,
+		Manifest:    c.WindowsResources.Manifest,
+		VersionInfo: c.WindowsResources.VersionInfo,
+	}
+}
+
+// override applies the configured overrides for a level of the platform of
+// opts, such as os/arch, see gox.ApplyOverrides.
+func (c *Config) override(opts *gox.CompileOpts, level []string) error {
+	if c == nil {
+		return nil
+	}
+
+	key := strings.Join(level, "/")
+	o, ok := c.Overrides[key]
+	if !ok {
+		return nil
+	}
+
+	if err := o.apply(opts); err != nil {
+		return fmt.Errorf("override %s: %s", key, err)
+	}
+
+	return nil
+}
+
+// packageMaxSize sets the size budget of opts to the one configured for its
+// package, if there is one.
+func (c *Config) packageMaxSize(opts *gox.CompileOpts) error {
+	if c == nil {
+		return nil
+	}
+
+	v, ok := c.PackageMaxSize[opts.PackagePath]
+	if !ok {
+		return nil
+	}
+
+	size, err := gox.ParseSize(v)
+	if err != nil {
+		return fmt.Errorf("package-max-size %s: %s", opts.PackagePath, err)
+	}
+
+	opts.MaxSize = size
+	return nil
+}
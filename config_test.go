@@ -0,0 +1,275 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/authelia/gox/gox"
+)
+
+func TestLoadConfig(t *testing.T) {
+	td := t.TempDir()
+
+	tomlPath := filepath.Join(td, "gox.toml")
+	err := os.WriteFile(tomlPath, []byte(`
+packages = ["./cmd/foo"]
+osarch = ["linux/amd64", "linux/arm"]
+ldflags = "-s -w"
+cgo = true
+
+[overrides."Linux/ARM"]
+cc = "arm-linux-gnueabihf-gcc"
+max-size = "8MiB"
+
+[windows-resources]
+icon = "app.ico"
+
+[windows-resources.version-info]
+CompanyName = "Acme"
+`), 0644)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	yamlPath := filepath.Join(td, "gox.yaml")
+	err = os.WriteFile(yamlPath, []byte(`
+packages: ["./cmd/foo"]
+osarch: ["linux/amd64", "linux/arm"]
+ldflags: "-s -w"
+cgo: true
+overrides:
+  Linux/ARM:
+    cc: arm-linux-gnueabihf-gcc
+    max-size: 8MiB
+windows-resources:
+  icon: app.ico
+  version-info:
+    CompanyName: Acme
+`), 0644)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	enabled := true
+	expected := &Config{
+		Packages: []string{"./cmd/foo"},
+		OSArch:   []string{"linux/amd64", "linux/arm"},
+		Ldflags:  "-s -w",
+		Cgo:      &enabled,
+		Overrides: map[string]PlatformOverride{
+			"linux/arm": {Cc: "arm-linux-gnueabihf-gcc", MaxSize: "8MiB"},
+		},
+		WindowsResources: &WindowsResources{
+			Icon:        "app.ico",
+			VersionInfo: map[string]string{"CompanyName": "Acme"},
+		},
+	}
+
+	for _, path := range []string{tomlPath, yamlPath} {
+		config, err := LoadConfig(path)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if !reflect.DeepEqual(config, expected) {
+			t.Fatalf("bad: %s: %#v", path, config)
+		}
+	}
+
+	if _, err := LoadConfig(filepath.Join(td, "gox.json")); err == nil {
+		t.Fatal("expected error for missing config")
+	}
+
+	// Unknown keys, such as those with underscores, are an error.
+	unknown := map[string]string{
+		"gox.toml": "[overrides.linux]\nmax_size = \"8MiB\"\n",
+		"gox.yaml": "overrides:\n  linux:\n    max_size: 8MiB\n",
+		"gox.yml":  "ldflag: -s\n",
+	}
+	for name, data := range unknown {
+		path := filepath.Join(td, "unknown", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if _, err := LoadConfig(path); err == nil {
+			t.Fatalf("%s: expected error for unknown key", name)
+		}
+	}
+}
+
+func TestConfigApplyFlags(t *testing.T) {
+	var platformFlag gox.PlatformFlag
+	var ldflags, tags string
+	var cgo, race, trimpath bool
+	var parallel int
+	var stamp stringList
+
+	flags := flag.NewFlagSet("gox", flag.ContinueOnError)
+	flags.Var(platformFlag.OSArchFlagValue(), "osarch", "")
+	flags.StringVar(&ldflags, "ldflags", "", "")
+	flags.StringVar(&tags, "tags", "", "")
+	flags.BoolVar(&cgo, "cgo", false, "")
+	flags.BoolVar(&race, "race", false, "")
+	flags.BoolVar(&trimpath, "trimpath", true, "")
+	flags.IntVar(&parallel, "parallel", -1, "")
+	flags.Var(&stamp, "stamp", "")
+	if err := flags.Parse([]string{"-ldflags=-X main.foo=bar", "-cgo=false"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// A boolean set to false in the config is honoured, unlike one that
+	// isn't set.
+	enabled, disabled := true, false
+	config := &Config{
+		OSArch:   []string{"linux/amd64", "darwin/arm64"},
+		Ldflags:  "-s -w",
+		Tags:     "netgo",
+		Cgo:      &enabled,
+		TrimPath: &disabled,
+		Parallel: 2,
+		Stamp:    map[string]string{"main.version": "version", "main.commit": "commit"},
+	}
+	if err := config.ApplyFlags(flags); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if ldflags != "-X main.foo=bar" {
+		t.Fatalf("bad ldflags: %s", ldflags)
+	}
+	if tags != "netgo" {
+		t.Fatalf("bad tags: %s", tags)
+	}
+	if cgo || race || trimpath {
+		t.Fatalf("bad cgo/race/trimpath: %v/%v/%v", cgo, race, trimpath)
+	}
+	if parallel != 2 {
+		t.Fatalf("bad parallel: %d", parallel)
+	}
+	if !reflect.DeepEqual(stamp, stringList{"main.commit=commit", "main.version=version"}) {
+		t.Fatalf("bad stamp: %#v", stamp)
+	}
+
+	expected := []gox.Platform{
+		{OS: "linux", Arch: "amd64"},
+		{OS: "darwin", Arch: "arm64"},
+	}
+	if !reflect.DeepEqual(platformFlag.OSArch, expected) {
+		t.Fatalf("bad: %#v", platformFlag.OSArch)
+	}
+}
+
+func TestConfigOverride(t *testing.T) {
+	disabled := false
+	config := &Config{
+		Overrides: map[string]PlatformOverride{
+			"linux":     {Ldflags: "-s", Tags: "netgo"},
+			"arm":       {Ldflags: "+-w", CgoEnabled: &disabled},
+			"linux/arm": {Cc: "arm-gcc", MaxSize: "8MiB", Env: map[string]string{"GOARM": "6", "FOO": "bar"}},
+			"linux/arm/7": {
+				Tags: "+v7",
+				Env:  map[string]string{"FOO": "baz"},
+			},
+		},
+	}
+
+	opts := &gox.CompileOpts{
+		Platform: gox.Platform{OS: "linux", Arch: "arm", Variant: "7"},
+		Ldflags:  "-X main.foo=bar",
+		Gcflags:  "-N",
+	}
+	if err := gox.ApplyOverrides(opts, config.override); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := &gox.CompileOpts{
+		Platform:   opts.Platform,
+		Ldflags:    "-s -w",
+		Gcflags:    "-N",
+		Tags:       "netgo v7",
+		Cc:         "arm-gcc",
+		DisableCgo: true,
+		MaxSize:    8 << 20,
+		Env:        []string{"FOO=baz", "GOARM=6"},
+	}
+	if !reflect.DeepEqual(opts, expected) {
+		t.Fatalf("bad: %#v", opts)
+	}
+
+	opts = &gox.CompileOpts{
+		Platform: gox.Platform{OS: "darwin", Arch: "amd64"},
+		Ldflags:  "-w",
+	}
+	if err := gox.ApplyOverrides(opts, config.override); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if opts.Ldflags != "-w" {
+		t.Fatalf("bad: %#v", opts)
+	}
+
+	// A nil config is a no-op
+	var nilConfig *Config
+	if err := gox.ApplyOverrides(opts, nilConfig.override); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestConfigOverride_env(t *testing.T) {
+	t.Setenv("GOX_LINUX_LDFLAGS", "-s")
+	t.Setenv("GOX_LINUX_ARM_TAGS", "+env")
+
+	config := &Config{
+		Overrides: map[string]PlatformOverride{
+			"linux":       {Ldflags: "-w", Tags: "netgo"},
+			"linux/arm":   {Tags: "+config"},
+			"linux/arm/7": {Ldflags: "-X main.arm=7"},
+		},
+	}
+
+	// The environment only wins at the same level, so an override for a
+	// more specific level in the config wins over a broader one in the
+	// environment.
+	opts := &gox.CompileOpts{Platform: gox.Platform{OS: "linux", Arch: "arm", Variant: "7"}}
+	if err := gox.ApplyOverrides(opts, config.override); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if opts.Ldflags != "-X main.arm=7" || opts.Tags != "netgo config env" {
+		t.Fatalf("bad: %#v", opts)
+	}
+
+	opts = &gox.CompileOpts{Platform: gox.Platform{OS: "linux", Arch: "amd64"}}
+	if err := gox.ApplyOverrides(opts, config.override); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if opts.Ldflags != "-s" || opts.Tags != "netgo" {
+		t.Fatalf("bad: %#v", opts)
+	}
+}
+
+func TestConfigPackageMaxSize(t *testing.T) {
+	config := &Config{
+		PackageMaxSize: map[string]string{"example.com/foo": "2MB"},
+	}
+
+	opts := &gox.CompileOpts{PackagePath: "example.com/foo", MaxSize: 1}
+	if err := config.packageMaxSize(opts); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if opts.MaxSize != 2000000 {
+		t.Fatalf("bad: %d", opts.MaxSize)
+	}
+
+	opts = &gox.CompileOpts{PackagePath: "example.com/bar", MaxSize: 1}
+	if err := config.packageMaxSize(opts); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if opts.MaxSize != 1 {
+		t.Fatalf("bad: %d", opts.MaxSize)
+	}
+}
@@ -1,8 +1,17 @@
 module github.com/authelia/gox
 
-go 1.23
+go 1.23.0
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/hashicorp/go-version v1.7.0
 	github.com/mitchellh/iochan v1.0.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require github.com/klauspost/compress v1.17.11
+
+require (
+	golang.org/x/crypto v0.36.0
+	golang.org/x/sys v0.31.0 // indirect
 )
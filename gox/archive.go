@@ -0,0 +1,376 @@
+package gox
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ArchiveOpts are the options for packaging a single build output.
+type ArchiveOpts struct {
+	// Binary is the path to the build output to package.
+	Binary string
+
+	// TemplateData is the data for OutputTpl. If OutputTpl is empty then
+	// the archive is written next to the binary using the binary's name.
+	TemplateData OutputTemplateData
+	OutputTpl    string
+
+	// Format is one of "tar.gz", "tar.zst" or "zip".
+	Format string
+
+	// Files are globs of extra files, such as LICENSE or README.md, to
+	// include in the archive alongside the binary.
+	Files []string
+}
+
+// ArchiveConfig is how a Builder packages each binary into an archive,
+// see CreateArchive.
+type ArchiveConfig struct {
+	// Formats is the format of the archives for each OS.
+	Formats ArchiveFormats
+
+	// OutputTpl and Files are those of the ArchiveOpts of every archive.
+	OutputTpl string
+	Files     []string
+}
+
+// opts returns the options of the archive of the binary of the job.
+func (c *ArchiveConfig) opts(job *Job, binary string) *ArchiveOpts {
+	return &ArchiveOpts{
+		Binary:       binary,
+		TemplateData: NewOutputTemplateData(job.Opts),
+		OutputTpl:    c.OutputTpl,
+		Format:       c.Formats.Format(job.Platform.OS),
+		Files:        c.Files,
+	}
+}
+
+// archive packages the binary of the job into an archive.
+func (c *ArchiveConfig) archive(job *Job, binary Artifact, goVersion string) (Artifact, error) {
+	archive, err := CreateArchive(c.opts(job, binary.Path))
+	if err != nil {
+		return Artifact{}, err
+	}
+
+	return NewArtifact("archive", job.Package, archive, job.Opts, binary.Duration, goVersion), nil
+}
+
+// checkPaths returns an error if the archives of two of the jobs would
+// have the same path, so that one would overwrite the other, such as with
+// an output template without {{.Arch}}.
+func (c *ArchiveConfig) checkPaths(jobs []*Job) error {
+	seen := make(map[string]*Job)
+	for _, job := range jobs {
+		binary, err := OutputPath(job.Opts)
+		if err != nil {
+			return err
+		}
+
+		path, err := archivePath(c.opts(job, binary))
+		if err != nil {
+			return err
+		}
+
+		if other, ok := seen[path]; ok {
+			return fmt.Errorf("the archives of %s %s and %s %s are both %s",
+				other.Package, other.Platform.String(), job.Package, job.Platform.String(), path)
+		}
+		seen[path] = job
+	}
+
+	return nil
+}
+
+// archiveFile is a single file to be written to an archive.
+type archiveFile struct {
+	name string
+	path string
+	mode int64
+}
+
+// CreateArchive packages the binary and extra files given in opts into an
+// archive and returns the absolute path to it. The archive is reproducible:
+// files are always in the same order and have fixed owners, permissions
+// and modification times.
+func CreateArchive(opts *ArchiveOpts) (string, error) {
+	archivePath, err := archivePath(opts)
+	if err != nil {
+		return "", err
+	}
+
+	files := []archiveFile{{
+		name: filepath.Base(opts.Binary),
+		path: opts.Binary,
+		mode: 0755,
+	}}
+
+	extra, err := archiveGlob(opts.Files)
+	if err != nil {
+		return "", err
+	}
+	files = append(files, extra...)
+
+	var buf bytes.Buffer
+	switch opts.Format {
+	case "tar.gz":
+		gw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		if err != nil {
+			return "", err
+		}
+		if err := writeTar(gw, files); err != nil {
+			return "", err
+		}
+		if err := gw.Close(); err != nil {
+			return "", err
+		}
+	case "tar.zst":
+		zw, err := zstd.NewWriter(&buf,
+			zstd.WithEncoderConcurrency(1),
+			zstd.WithEncoderLevel(zstd.SpeedBestCompression))
+		if err != nil {
+			return "", err
+		}
+		if err := writeTar(zw, files); err != nil {
+			return "", err
+		}
+		if err := zw.Close(); err != nil {
+			return "", err
+		}
+	case "zip":
+		if err := writeZip(&buf, files); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("unknown archive format: %s", opts.Format)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(archivePath), 0755); err != nil {
+		return "", err
+	}
+
+	if err := os.WriteFile(archivePath, buf.Bytes(), 0644); err != nil {
+		return "", err
+	}
+
+	return archivePath, nil
+}
+
+// archivePath returns the absolute path of the archive, including the
+// extension for the format.
+func archivePath(opts *ArchiveOpts) (string, error) {
+	path := strings.TrimSuffix(opts.Binary, ".exe")
+	if opts.OutputTpl != "" {
+		output, err := executeTemplate("archive", opts.OutputTpl, &opts.TemplateData)
+		if err != nil {
+			return "", err
+		}
+
+		path = output
+	}
+
+	return filepath.Abs(path + "." + opts.Format)
+}
+
+// archiveGlob expands the globs of extra files into a sorted list. Every
+// glob must match at least one file so that typos don't go unnoticed.
+// Files outside of the current directory are named after their base name,
+// and it is an error if that is the name of another file.
+func archiveGlob(globs []string) ([]archiveFile, error) {
+	seen := make(map[string]string)
+	files := make([]archiveFile, 0, len(globs))
+	for _, glob := range globs {
+		matches, err := filepath.Glob(glob)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files found matching %q", glob)
+		}
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if info.IsDir() {
+				continue
+			}
+
+			// Relative paths are kept so that directories are preserved,
+			// but absolute paths and those outside of the current
+			// directory, such as "../LICENSE", are placed at the root of
+			// the archive so that no entry escapes where it is extracted.
+			name := filepath.ToSlash(filepath.Clean(match))
+			if !filepath.IsLocal(match) {
+				name = filepath.Base(match)
+			}
+			// The same file may be matched by more than one glob, but
+			// two files can't have the same name.
+			if other, ok := seen[name]; ok {
+				if filepath.Clean(other) == filepath.Clean(match) {
+					continue
+				}
+				return nil, fmt.Errorf("%s and %s are both archived as %s", other, match, name)
+			}
+			seen[name] = match
+
+			files = append(files, archiveFile{
+				name: name,
+				path: match,
+				mode: 0644,
+			})
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].name < files[j].name
+	})
+
+	return files, nil
+}
+
+// archiveModTime returns the modification time used for every file in an
+// archive. SOURCE_DATE_EPOCH is respected if it is set, otherwise a fixed
+// time is used that is also representable in zip files.
+func archiveModTime() time.Time {
+	if v := os.Getenv("SOURCE_DATE_EPOCH"); v != "" {
+		if epoch, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return time.Unix(epoch, 0).UTC()
+		}
+	}
+
+	return time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func writeTar(w io.Writer, files []archiveFile) error {
+	modTime := archiveModTime()
+
+	tw := tar.NewWriter(w)
+	for _, f := range files {
+		data, err := os.ReadFile(f.path)
+		if err != nil {
+			return err
+		}
+
+		err = tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     f.name,
+			Mode:     f.mode,
+			Size:     int64(len(data)),
+			ModTime:  modTime,
+		})
+		if err != nil {
+			return err
+		}
+
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+func writeZip(w io.Writer, files []archiveFile) error {
+	modTime := archiveModTime()
+
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		data, err := os.ReadFile(f.path)
+		if err != nil {
+			return err
+		}
+
+		header := &zip.FileHeader{
+			Name:     f.name,
+			Method:   zip.Deflate,
+			Modified: modTime,
+		}
+		header.SetMode(os.FileMode(f.mode))
+
+		fw, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+
+		if _, err := fw.Write(data); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// ArchiveFormats is a flag.Value that holds the archive format to use for
+// each OS. A plain format such as "tar.gz" sets the default while an
+// "os=format" entry, such as "windows=zip", sets it for a single OS.
+type ArchiveFormats struct {
+	Default string
+	OS      map[string]string
+}
+
+func (a *ArchiveFormats) String() string {
+	if a == nil {
+		return ""
+	}
+
+	parts := []string{a.Default}
+	for os, format := range a.OS {
+		parts = append(parts, os+"="+format)
+	}
+	sort.Strings(parts[1:])
+
+	return strings.Join(parts, " ")
+}
+
+func (a *ArchiveFormats) Set(value string) error {
+	for _, v := range strings.Split(value, " ") {
+		if v == "" {
+			continue
+		}
+
+		os, format := "", strings.ToLower(v)
+		if idx := strings.Index(format, "="); idx >= 0 {
+			os, format = format[:idx], format[idx+1:]
+		}
+
+		switch format {
+		case "tar.gz", "tar.zst", "zip":
+		default:
+			return fmt.Errorf("unknown archive format: %s", format)
+		}
+
+		if os == "" {
+			a.Default = format
+			continue
+		}
+
+		if a.OS == nil {
+			a.OS = make(map[string]string)
+		}
+		a.OS[os] = format
+	}
+
+	return nil
+}
+
+// Format returns the archive format for the given OS.
+func (a *ArchiveFormats) Format(os string) string {
+	if format, ok := a.OS[os]; ok {
+		return format
+	}
+
+	return a.Default
+}
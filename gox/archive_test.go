@@ -0,0 +1,216 @@
+package gox
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestCreateArchive(t *testing.T) {
+	td := t.TempDir()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := os.Chdir(td); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Chdir(wd)
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+
+	for name, data := range map[string]string{
+		"foo_linux_amd64": "binary",
+		"README.md":       "readme",
+		"LICENSE":         "license",
+	} {
+		if err := os.WriteFile(name, []byte(data), 0600); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	for _, format := range []string{"tar.gz", "tar.zst", "zip"} {
+		opts := &ArchiveOpts{
+			Binary:       filepath.Join(td, "foo_linux_amd64"),
+			TemplateData: OutputTemplateData{Dir: "foo", OS: "linux", Arch: "amd64"},
+			OutputTpl:    "dist/{{.Dir}}-{{.OS}}-{{.Arch}}",
+			Format:       format,
+			Files:        []string{"README*", "LICENSE"},
+		}
+
+		path, err := CreateArchive(opts)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if path != filepath.Join(td, "dist", "foo-linux-amd64."+format) {
+			t.Fatalf("bad: %s", path)
+		}
+
+		first, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		// Archives must be byte for byte reproducible
+		if _, err := CreateArchive(opts); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		second, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if !bytes.Equal(first, second) {
+			t.Fatalf("%s: archive is not reproducible", format)
+		}
+
+		names, modes := readArchive(t, format, first)
+		if !reflect.DeepEqual(names, []string{"foo_linux_amd64", "LICENSE", "README.md"}) {
+			t.Fatalf("%s: bad: %#v", format, names)
+		}
+		if !reflect.DeepEqual(modes, []os.FileMode{0755, 0644, 0644}) {
+			t.Fatalf("%s: bad: %#v", format, modes)
+		}
+	}
+
+	_, err = CreateArchive(&ArchiveOpts{
+		Binary: filepath.Join(td, "foo_linux_amd64"),
+		Format: "tar.gz",
+		Files:  []string{"CHANGELOG*"},
+	})
+	if err == nil {
+		t.Fatal("expected error for glob without matches")
+	}
+}
+
+func TestArchiveGlob(t *testing.T) {
+	td := t.TempDir()
+	for _, name := range []string{"LICENSE", "app/docs/README.md", "app/NOTICE"} {
+		path := filepath.Join(td, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := os.Chdir(filepath.Join(td, "app")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Chdir(wd)
+
+	files, err := archiveGlob([]string{"../LICENSE", "docs/*", "./docs/../NOTICE"})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		names = append(names, f.name)
+	}
+	if !reflect.DeepEqual(names, []string{"LICENSE", "NOTICE", "docs/README.md"}) {
+		t.Fatalf("bad: %#v", names)
+	}
+
+	// A file may be matched twice, but another one can't take its name.
+	if files, err := archiveGlob([]string{"../LICENSE", "../LICEN*"}); err != nil || len(files) != 1 {
+		t.Fatalf("bad: %#v %v", files, err)
+	}
+	if err := os.WriteFile("LICENSE", nil, 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	_, err = archiveGlob([]string{"../LICENSE", "LICENSE"})
+	if err == nil || err.Error() != "../LICENSE and LICENSE are both archived as LICENSE" {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func readArchive(t *testing.T, format string, data []byte) ([]string, []os.FileMode) {
+	var names []string
+	var modes []os.FileMode
+
+	if format == "zip" {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		for _, f := range zr.File {
+			names = append(names, f.Name)
+			modes = append(modes, f.Mode().Perm())
+		}
+
+		return names, modes
+	}
+
+	var r io.Reader
+	if format == "tar.gz" {
+		gr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		r = gr
+	} else {
+		zr, err := zstd.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if h.ModTime.Unix() != 1700000000 {
+			t.Fatalf("bad mtime: %s", h.ModTime)
+		}
+
+		names = append(names, h.Name)
+		modes = append(modes, os.FileMode(h.Mode))
+	}
+
+	return names, modes
+}
+
+func TestArchiveFormats(t *testing.T) {
+	formats := ArchiveFormats{
+		Default: "tar.gz",
+		OS:      map[string]string{"windows": "zip"},
+	}
+
+	if err := formats.Set("tar.zst darwin=zip"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if formats.Format("linux") != "tar.zst" {
+		t.Fatalf("bad: %s", formats.Format("linux"))
+	}
+	if formats.Format("windows") != "zip" || formats.Format("darwin") != "zip" {
+		t.Fatalf("bad: %s", formats.String())
+	}
+	if formats.String() != "tar.zst darwin=zip windows=zip" {
+		t.Fatalf("bad: %s", formats.String())
+	}
+
+	if err := formats.Set("rar"); err == nil {
+		t.Fatal("should err")
+	}
+}
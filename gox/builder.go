@@ -0,0 +1,599 @@
+// Package gox cross-compiles Go packages for many platforms in parallel.
+//
+// GoCrossCompile builds a single package for a single platform. A Builder
+// plans and runs the builds of many packages for many platforms, reporting
+// their progress to a Reporter:
+//
+//	b := &gox.Builder{Parallel: 4, Reporter: gox.NewHumanReporter(os.Stdout, os.Stderr)}
+//	jobs, err := b.Plan([]string{"example.com/cmd/foo"}, gox.SupportedPlatforms(v), nil)
+//	if err != nil {
+//		return err
+//	}
+//	results := b.Build(ctx, jobs)
+package gox
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Job is the build of a single package for a single platform.
+type Job struct {
+	Package  string
+	Platform Platform
+	Opts     *CompileOpts
+
+	// Dir is the directory of the package, which Plan only resolves for
+	// the builds that need it, those with hooks or Windows resources.
+	Dir string
+
+	// Skip is the reason the job is skipped instead of built, if it is.
+	Skip string
+}
+
+// Result is the outcome of a single Job.
+type Result struct {
+	Job *Job
+
+	// Artifacts are the files produced by a successful build, starting
+	// with the binary and followed by any returned by PostBuild.
+	Artifacts []Artifact
+
+	// Elapsed is the time taken to build the binary.
+	Elapsed time.Duration
+
+	// Err is the error if the build failed.
+	Err error
+
+	// Skip is the reason the job wasn't built, either the one it was
+	// planned with or "canceled" if the builds were canceled first.
+	Skip string
+}
+
+// UnsupportedError is returned by Plan when some of the platforms don't
+// support the options of their builds.
+type UnsupportedError struct {
+	// Jobs are the unsupported jobs, with Skip set to the reason.
+	Jobs []*Job
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("%d builds are unsupported", len(e.Jobs))
+}
+
+// Builder builds packages for many platforms in parallel.
+type Builder struct {
+	// Parallel is the number of builds run at once. It defaults to one.
+	Parallel int
+
+	// Retry is how a failed build is retried, see GoCrossCompileRetry.
+	Retry RetryOpts
+
+	// FailFast cancels every other build once one fails.
+	FailFast bool
+
+	// SkipUnsupported makes Plan skip the jobs that the platform doesn't
+	// support, instead of failing. HasCgo is whether the platforms have
+	// their cgo support set, see CheckSupported.
+	SkipUnsupported bool
+	HasCgo          bool
+
+	// GoVersion is the version of Go reported in the plan and recorded
+	// in the artifacts.
+	GoVersion string
+
+	// Reporter receives the progress of the builds, if it isn't nil.
+	Reporter Reporter
+
+	// PreHooks and PostHooks are the commands run before and after each
+	// job is built, see RunHook. A hook that fails fails the job. The
+	// post-build hooks run before the size budget is checked, so that they
+	// can compress the binary.
+	PreHooks  []string
+	PostHooks []string
+
+	// Universal merges the darwin/amd64 and darwin/arm64 binaries of each
+	// package into a universal binary, see CreateUniversal, once both are
+	// built. Its platform is darwin/universal, so its output is that of
+	// the package with "universal" as the architecture. UniversalReplace
+	// removes the thin binaries, and anything made from them, once the
+	// universal binary is done, leaving their results without artifacts.
+	Universal        bool
+	UniversalReplace bool
+
+	// WindowsResources, if not nil, are embedded into the binaries for
+	// Windows, see WriteSyso. The .syso file is written into the directory
+	// of the package for the build and removed afterwards.
+	WindowsResources *WindowsResources
+
+	// Codesign signs the darwin binaries with an ad-hoc code signature,
+	// see CodesignAdhoc, after the post-build hooks, so universal binaries
+	// are made from signed slices. Entitlements is the path of a property
+	// list of the entitlements to sign them with, if any.
+	Codesign     bool
+	Entitlements string
+
+	// SkipVerify skips checking that each binary is for the platform it
+	// was built for, see VerifyBinary, right after it is built.
+	SkipVerify bool
+
+	// SBOM are the formats, see SBOMFormats, of the SBOMs written next to
+	// each binary once it is built, see WriteSBOM.
+	SBOM []string
+
+	// Log is called, if it isn't nil, before each job is built and returns
+	// the writer that the output of go build is streamed to. It is closed
+	// once the build is done.
+	Log func(job *Job) (io.WriteCloser, error)
+
+	// Archive, if it isn't nil, packages each binary into an archive once
+	// it is built, see CreateArchive.
+	Archive *ArchiveConfig
+
+	// PostBuild is called, if it isn't nil, once the binary of a job is
+	// built and archived. It returns any further artifacts made from the
+	// binary. An error fails the job.
+	PostBuild func(ctx context.Context, job *Job, binary Artifact) ([]Artifact, error)
+
+	// Checksum and Manifest are how the checksums, see WriteChecksums,
+	// and the path of the manifest, see WriteManifest, of the artifacts
+	// are written by WriteArtifacts.
+	Checksum *ChecksumOpts
+	Manifest string
+}
+
+// Templates returns the templates executed for every build other than
+// those of its options: those of the hooks and of the archive path.
+func (b *Builder) Templates() []string {
+	templates := append([]string{}, b.PreHooks...)
+	templates = append(templates, b.PostHooks...)
+	if b.Archive != nil {
+		templates = append(templates, b.Archive.OutputTpl)
+	}
+
+	return templates
+}
+
+// Plan returns a job for every package on every platform, with the options
+// returned by newOpts or the defaults if it is nil. If some platforms don't
+// support the options of their jobs then Plan returns an *UnsupportedError
+// listing them, unless SkipUnsupported is set in which case those jobs are
+// returned with Skip set.
+func (b *Builder) Plan(packages []string, platforms []Platform, newOpts func(pkg string, platform Platform) (*CompileOpts, error)) ([]*Job, error) {
+	if newOpts == nil {
+		newOpts = func(pkg string, platform Platform) (*CompileOpts, error) {
+			return &CompileOpts{
+				PackagePath: pkg,
+				Platform:    platform,
+				OutputTpl:   DefaultOutputTpl,
+				GoCmd:       "go",
+			}, nil
+		}
+	}
+
+	// The hooks run in the directory of the package, and the resources
+	// are written into it, so it is resolved once for every package.
+	needDir := len(b.PreHooks) > 0 || len(b.PostHooks) > 0 || b.WindowsResources != nil
+	dirs := make(map[string]string)
+
+	jobs := make([]*Job, 0, len(platforms)*len(packages))
+	unsupported := make([]*Job, 0)
+	for _, platform := range platforms {
+		for _, pkg := range packages {
+			opts, err := newOpts(pkg, platform)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", platform.String(), err)
+			}
+
+			if _, ok := dirs[pkg]; needDir && !ok {
+				if dirs[pkg], err = packageDir(opts); err != nil {
+					return nil, fmt.Errorf("%s: %s", pkg, err)
+				}
+			}
+
+			job := &Job{Package: pkg, Platform: platform, Opts: opts, Dir: dirs[pkg]}
+			if err := CheckSupported(opts, b.HasCgo); err != nil {
+				job.Skip = err.Error()
+				unsupported = append(unsupported, job)
+			} else if b.WindowsResources != nil && platform.OS == "windows" && !WindowsResourcesSupported(platform.Arch) {
+				job.Skip = "windows resources aren't supported on " + platform.Arch
+				unsupported = append(unsupported, job)
+			}
+
+			jobs = append(jobs, job)
+		}
+	}
+
+	for _, hooks := range [][]string{b.PreHooks, b.PostHooks} {
+		for _, hook := range hooks {
+			if err := ValidateHook(hook); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if b.WindowsResources != nil {
+		if err := b.WindowsResources.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if b.Archive != nil {
+		if err := b.Archive.checkPaths(b.archived(jobs)); err != nil {
+			return nil, err
+		}
+	}
+
+	if b.Checksum != nil {
+		if _, ok := ChecksumAlgorithms[b.Checksum.Algorithm]; !ok {
+			return nil, fmt.Errorf("unknown checksum algorithm: %s", b.Checksum.Algorithm)
+		}
+	}
+
+	for _, format := range b.SBOM {
+		if _, ok := SBOMFormats[format]; !ok {
+			return nil, fmt.Errorf("unknown SBOM format: %s", format)
+		}
+	}
+
+	if b.Entitlements != "" {
+		if _, err := readEntitlements(b.Entitlements); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(unsupported) > 0 && !b.SkipUnsupported {
+		return nil, &UnsupportedError{Jobs: unsupported}
+	}
+
+	return jobs, nil
+}
+
+// archived returns the jobs that are archived: those that aren't skipped
+// and, with Universal, those of the universal binaries they are merged
+// into.
+func (b *Builder) archived(jobs []*Job) []*Job {
+	archived := make([]*Job, 0, len(jobs))
+	darwin := make(map[string]map[string]*Job)
+	for _, job := range jobs {
+		if job.Skip != "" {
+			continue
+		}
+		archived = append(archived, job)
+
+		if job.Platform.OS == "darwin" && job.Platform.Variant == "" {
+			if darwin[job.Package] == nil {
+				darwin[job.Package] = make(map[string]*Job)
+			}
+			darwin[job.Package][job.Platform.Arch] = job
+		}
+	}
+
+	if b.Universal {
+		for _, job := range archived {
+			arches := darwin[job.Package]
+			if job.Platform.OS != "darwin" || job.Platform.Variant != "" || job.Platform.Arch != universalArchs[len(universalArchs)-1] {
+				continue
+			}
+			merged := true
+			for _, arch := range universalArchs {
+				merged = merged && arches[arch] != nil
+			}
+			if merged {
+				archived = append(archived, universalJob(job))
+			}
+		}
+	}
+
+	return archived
+}
+
+// packageDir returns the directory of the package of opts. Packages
+// outside of a module or GOPATH are built in their directory already.
+func packageDir(opts *CompileOpts) (string, error) {
+	if cmd, err := GoBuildCommand(opts); err == nil && cmd.Dir != "" {
+		return cmd.Dir, nil
+	}
+
+	return PackageDir(context.Background(), opts.PackagePath, opts.GoCmd)
+}
+
+// Build runs the jobs, at most Parallel at a time, and returns their
+// results in the same order, followed by those of the universal binaries.
+// Once ctx is done the running builds are killed and the rest are
+// skipped.
+func (b *Builder) Build(ctx context.Context, jobs []*Job) []*Result {
+	parallel := b.Parallel
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	reporter := b.Reporter
+	if reporter == nil {
+		reporter = nopReporter{}
+	}
+
+	// With FailFast the first failure cancels every other build.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	packages, platforms := planned(jobs)
+	reporter.Plan(b.GoVersion, packages, platforms, parallel)
+
+	results := make([]*Result, len(jobs))
+	for i, job := range jobs {
+		results[i] = &Result{Job: job, Skip: job.Skip}
+		if job.Skip != "" {
+			reporter.BuildSkip(job.Package, job.Platform, job.Skip)
+		}
+	}
+
+	var syso map[string][]string
+	if b.WindowsResources != nil {
+		syso = sysoPaths(jobs)
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	semaphore := make(chan int, parallel)
+	for _, result := range results {
+		if result.Skip != "" {
+			continue
+		}
+
+		// Start the goroutine that will do the actual build
+		wg.Add(1)
+		go func(result *Result) {
+			defer wg.Done()
+			job := result.Job
+			select {
+			case semaphore <- 1:
+			case <-ctx.Done():
+				result.Skip = "canceled"
+				reporter.BuildSkip(job.Package, job.Platform, result.Skip)
+				return
+			}
+			defer func() { <-semaphore }()
+
+			// The context may be done while waiting for the semaphore.
+			if ctx.Err() != nil {
+				result.Skip = "canceled"
+				reporter.BuildSkip(job.Package, job.Platform, result.Skip)
+				return
+			}
+
+			reporter.BuildStart(job.Package, job.Platform)
+			b.build(ctx, result, syso[job.Dir])
+
+			if ctx.Err() != nil {
+				// Don't report the builds killed by the cancellation as
+				// failures, and don't leave behind what was made from them.
+				if len(result.Artifacts) > 1 {
+					for _, a := range result.Artifacts[1:] {
+						os.Remove(a.Path)
+					}
+				}
+				result.Artifacts = nil
+				result.Err = nil
+				result.Skip = "canceled"
+				reporter.BuildSkip(job.Package, job.Platform, result.Skip)
+				return
+			}
+			reporter.BuildFinish(job.Package, job.Platform, result.Elapsed, result.Err)
+
+			if result.Err != nil && b.FailFast {
+				cancel()
+			}
+		}(result)
+	}
+	wg.Wait()
+
+	if b.Universal {
+		results = append(results, b.buildUniversal(ctx, results, reporter)...)
+	}
+
+	reporter.Summary(time.Since(start))
+	return results
+}
+
+// build builds the job of the result, filling in the rest of it. syso are
+// the .syso files of the Windows resources of the builds of the package.
+func (b *Builder) build(ctx context.Context, result *Result, syso []string) {
+	job := result.Job
+
+	if b.Log != nil {
+		log, err := b.Log(job)
+		if err != nil {
+			result.Err = err
+			return
+		}
+		defer log.Close()
+
+		job.Opts.Log = log
+	}
+
+	var hookData *HookTemplateData
+	var cmd *BuildCommand
+	if len(b.PreHooks) > 0 || len(b.PostHooks) > 0 {
+		var err error
+		if cmd, err = GoBuildCommand(job.Opts); err != nil {
+			result.Err = err
+			return
+		}
+
+		hookData = newHookTemplateData(job, cmd)
+	}
+
+	for _, hook := range b.PreHooks {
+		if err := RunHook(ctx, hook, job.Dir, cmd, hookData, job.Opts.Log); err != nil {
+			result.Err = err
+			return
+		}
+	}
+
+	if b.WindowsResources != nil && job.Platform.OS == "windows" {
+		cleanup, err := embedWindowsResources(job, b.WindowsResources, syso)
+		if err != nil {
+			result.Err = err
+			return
+		}
+		defer cleanup()
+	}
+
+	start := time.Now()
+	output, err := GoCrossCompileRetry(ctx, job.Opts, b.Retry)
+	result.Elapsed = time.Since(start)
+	if err != nil {
+		result.Err = err
+		return
+	}
+
+	if !b.SkipVerify {
+		if err := VerifyBinary(output, job.Opts); err != nil {
+			result.Err = err
+			return
+		}
+	}
+
+	for _, hook := range b.PostHooks {
+		if err := RunHook(ctx, hook, job.Dir, cmd, hookData, job.Opts.Log); err != nil {
+			result.Err = err
+			return
+		}
+	}
+
+	if b.Codesign && job.Platform.OS == "darwin" {
+		if err := b.codesign(job, output); err != nil {
+			result.Err = err
+			return
+		}
+	}
+
+	binary := NewArtifact("binary", job.Package, output, job.Opts, result.Elapsed, b.GoVersion)
+	result.Artifacts = []Artifact{binary}
+
+	if job.Opts.MaxSize > 0 {
+		info, err := os.Stat(output)
+		if err != nil {
+			result.Err = err
+			return
+		}
+
+		if info.Size() > job.Opts.MaxSize {
+			result.Err = &SizeError{Size: info.Size(), MaxSize: job.Opts.MaxSize}
+			return
+		}
+	}
+
+	sboms, err := b.writeSBOMs(job, &binary)
+	result.Artifacts = append([]Artifact{binary}, sboms...)
+	if err != nil {
+		result.Err = err
+		return
+	}
+
+	built, err := b.postBuild(ctx, job, binary)
+	result.Artifacts = append(result.Artifacts, built...)
+	if err != nil {
+		result.Err = err
+	}
+}
+
+// postBuild returns the artifacts made from the binary of the job once it
+// is built: its archive, followed by those returned by PostBuild.
+func (b *Builder) postBuild(ctx context.Context, job *Job, binary Artifact) ([]Artifact, error) {
+	var built []Artifact
+	if b.Archive != nil {
+		archive, err := b.Archive.archive(job, binary, b.GoVersion)
+		if err != nil {
+			return nil, err
+		}
+		built = append(built, archive)
+	}
+
+	if b.PostBuild != nil {
+		more, err := b.PostBuild(ctx, job, binary)
+		built = append(built, more...)
+		if err != nil {
+			return built, err
+		}
+	}
+
+	return built, nil
+}
+
+// planned returns the packages and platforms of the jobs, in the order
+// they first appear.
+func planned(jobs []*Job) ([]string, []Platform) {
+	packages := make([]string, 0)
+	platforms := make([]Platform, 0)
+	seenPackages := make(map[string]bool)
+	seenPlatforms := make(map[string]bool)
+	for _, job := range jobs {
+		if !seenPackages[job.Package] {
+			seenPackages[job.Package] = true
+			packages = append(packages, job.Package)
+		}
+
+		if !seenPlatforms[job.Platform.String()] {
+			seenPlatforms[job.Platform.String()] = true
+			platforms = append(platforms, job.Platform)
+		}
+	}
+
+	return packages, platforms
+}
+
+// WriteArtifacts writes the checksums and then the manifest of the
+// artifacts, if Checksum and Manifest are set. The manifest has checksums
+// of the same algorithm, or sha256 without Checksum. They should only be
+// written once every build has succeeded, so that they never cover a
+// partial set of artifacts.
+func (b *Builder) WriteArtifacts(artifacts []Artifact) error {
+	algo := "sha256"
+	if b.Checksum != nil {
+		paths := make([]string, 0, len(artifacts))
+		for _, a := range artifacts {
+			paths = append(paths, a.Path)
+		}
+
+		if err := WriteChecksums(b.Checksum, paths); err != nil {
+			return fmt.Errorf("writing checksums: %s", err)
+		}
+		algo = b.Checksum.Algorithm
+	}
+
+	if b.Manifest != "" {
+		if err := WriteManifest(b.Manifest, algo, artifacts); err != nil {
+			return fmt.Errorf("writing manifest: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// Artifacts returns the artifacts of the results, in order.
+func Artifacts(results []*Result) []Artifact {
+	artifacts := make([]Artifact, 0, len(results))
+	for _, result := range results {
+		artifacts = append(artifacts, result.Artifacts...)
+	}
+
+	return artifacts
+}
+
+// Failed returns the number of results that failed.
+func Failed(results []*Result) int {
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+		}
+	}
+
+	return failed
+}
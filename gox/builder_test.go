@@ -0,0 +1,182 @@
+package gox
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuilderPlan(t *testing.T) {
+	platforms := []Platform{
+		{OS: "linux", Arch: "amd64"},
+		{OS: "js", Arch: "wasm"},
+	}
+	newOpts := func(pkg string, platform Platform) (*CompileOpts, error) {
+		return &CompileOpts{PackagePath: pkg, Platform: platform, Race: true, Cgo: true}, nil
+	}
+
+	b := &Builder{}
+	_, err := b.Plan([]string{"foo", "bar"}, platforms, newOpts)
+
+	var unsupported *UnsupportedError
+	if !errors.As(err, &unsupported) {
+		t.Fatalf("bad: %#v", err)
+	}
+	if len(unsupported.Jobs) != 2 || unsupported.Jobs[0].Platform.OS != "js" {
+		t.Fatalf("bad: %#v", unsupported.Jobs)
+	}
+
+	b.SkipUnsupported = true
+	jobs, err := b.Plan([]string{"foo", "bar"}, platforms, newOpts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(jobs) != 4 {
+		t.Fatalf("bad: %#v", jobs)
+	}
+	if jobs[0].Package != "foo" || jobs[0].Skip != "" {
+		t.Fatalf("bad: %#v", jobs[0])
+	}
+	if jobs[3].Package != "bar" || jobs[3].Skip == "" {
+		t.Fatalf("bad: %#v", jobs[3])
+	}
+}
+
+func TestBuilderPlan_archivePaths(t *testing.T) {
+	platforms := []Platform{
+		{OS: "darwin", Arch: "amd64"},
+		{OS: "darwin", Arch: "arm64"},
+		{OS: "linux", Arch: "amd64"},
+	}
+	newOpts := func(pkg string, platform Platform) (*CompileOpts, error) {
+		return &CompileOpts{PackagePath: pkg, Platform: platform, OutputTpl: DefaultOutputTpl}, nil
+	}
+
+	b := &Builder{Archive: &ArchiveConfig{Formats: ArchiveFormats{Default: "tar.gz"}, OutputTpl: "{{.Dir}}_{{.Arch}}"}}
+	if _, err := b.Plan([]string{"example.com/foo"}, platforms, newOpts); err == nil || !strings.Contains(err.Error(), "example.com/foo darwin/amd64 and example.com/foo linux/amd64 are both") {
+		t.Fatalf("bad: %v", err)
+	}
+
+	b.Archive.OutputTpl = "{{.Dir}}_{{.OS}}_{{.Arch}}"
+	if _, err := b.Plan([]string{"example.com/foo"}, platforms, newOpts); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	// The universal binary is archived as well.
+	b.Universal = true
+	b.Archive.OutputTpl = "{{.Dir}}_{{if eq .Arch \"universal\"}}{{.OS}}_arm64{{else}}{{.OS}}_{{.Arch}}{{end}}"
+	if _, err := b.Plan([]string{"example.com/foo"}, platforms, newOpts); err == nil || !strings.Contains(err.Error(), "darwin/arm64 and example.com/foo darwin/universal are both") {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestBuilderBuild(t *testing.T) {
+	dir := t.TempDir()
+	platforms := []Platform{
+		{OS: "linux", Arch: "amd64"},
+		{OS: "linux", Arch: "arm", Variant: "7"},
+	}
+
+	var postBuilt []string
+	b := &Builder{
+		Parallel: 2,
+		PostBuild: func(ctx context.Context, job *Job, binary Artifact) ([]Artifact, error) {
+			if job.Platform.Arch == "arm" {
+				return nil, errors.New("post-build failed")
+			}
+
+			postBuilt = append(postBuilt, binary.Path)
+			return nil, nil
+		},
+	}
+
+	jobs, err := b.Plan([]string{"github.com/authelia/gox"}, platforms, func(pkg string, platform Platform) (*CompileOpts, error) {
+		return &CompileOpts{
+			PackagePath: pkg,
+			Platform:    platform,
+			OutputTpl:   filepath.Join(dir, DefaultOutputTpl),
+			GoCmd:       "go",
+		}, nil
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	results := b.Build(context.Background(), jobs)
+	if len(results) != 2 || Failed(results) != 1 {
+		t.Fatalf("bad: %#v", results)
+	}
+
+	expected := filepath.Join(dir, "gox_linux_amd64")
+	if results[0].Err != nil || len(results[0].Artifacts) != 1 || results[0].Artifacts[0].Path != expected {
+		t.Fatalf("bad: %#v", results[0])
+	}
+	if len(postBuilt) != 1 || postBuilt[0] != expected {
+		t.Fatalf("bad: %#v", postBuilt)
+	}
+	if results[1].Err == nil || results[1].Err.Error() != "post-build failed" {
+		t.Fatalf("bad: %#v", results[1])
+	}
+}
+
+func TestBuilder_archive(t *testing.T) {
+	td := testModule(t, map[string]string{"LICENSE": "license\n"})
+	b := &Builder{
+		Parallel: 2,
+		Archive: &ArchiveConfig{
+			Formats: ArchiveFormats{Default: "tar.gz", OS: map[string]string{"windows": "zip"}},
+			Files:   []string{"LICENSE"},
+		},
+		Checksum: &ChecksumOpts{Algorithm: "sha256", Output: filepath.Join(td, "SHA256SUMS")},
+		Manifest: filepath.Join(td, "manifest.json"),
+	}
+	platforms := []Platform{{OS: "linux", Arch: "amd64"}, {OS: "windows", Arch: "amd64"}}
+	jobs, err := b.Plan([]string{"example.com/app"}, platforms, func(pkg string, platform Platform) (*CompileOpts, error) {
+		return &CompileOpts{
+			PackagePath: pkg,
+			Platform:    platform,
+			OutputTpl:   filepath.Join(td, DefaultOutputTpl),
+			GoCmd:       "go",
+		}, nil
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	results := b.Build(context.Background(), jobs)
+	if Failed(results) > 0 {
+		t.Fatalf("bad: %#v", results)
+	}
+
+	artifacts := Artifacts(results)
+	expected := []string{"app_linux_amd64", "app_linux_amd64.tar.gz", "app_windows_amd64.exe", "app_windows_amd64.zip"}
+	if len(artifacts) != len(expected) {
+		t.Fatalf("bad: %#v", artifacts)
+	}
+	for i, a := range artifacts {
+		if a.Path != filepath.Join(td, expected[i]) {
+			t.Fatalf("bad: %#v", a)
+		}
+	}
+
+	if err := b.WriteArtifacts(artifacts); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	manifest, err := ReadManifest(b.Manifest)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(manifest.Artifacts) != 4 || manifest.Artifacts[1].Type != "archive" {
+		t.Fatalf("bad: %#v", manifest)
+	}
+	sums, err := os.ReadFile(b.Checksum.Output)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if n := strings.Count(string(sums), "\n"); n != 4 {
+		t.Fatalf("bad: %s", sums)
+	}
+}
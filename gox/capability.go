@@ -0,0 +1,145 @@
+package gox
+
+import (
+	"fmt"
+)
+
+// The tables below mirror internal/platform in the Go source tree, which
+// go build itself uses to reject unsupported combinations. The toolchain
+// doesn't report them, except for cgo support which comes from
+// `go tool dist list -json` when available.
+
+// raceSupported are the platforms that support the race detector.
+var raceSupported = map[string]bool{
+	"linux/amd64":   true,
+	"linux/ppc64le": true,
+	"linux/arm64":   true,
+	"linux/s390x":   true,
+	"darwin/amd64":  true,
+	"darwin/arm64":  true,
+	"freebsd/amd64": true,
+	"netbsd/amd64":  true,
+	"windows/amd64": true,
+}
+
+// buildmodeSupported are the platforms that support each build mode, with
+// "*/*" for every platform. Build modes that aren't listed are unknown.
+var buildmodeSupported = map[string]map[string]bool{
+	"default": {"*/*": true},
+	"exe":     {"*/*": true},
+	"archive": {"*/*": true},
+	"c-archive": {
+		"aix/*": true, "darwin/*": true, "ios/*": true, "windows/*": true,
+		"linux/386": true, "linux/amd64": true, "linux/arm": true,
+		"linux/arm64": true, "linux/loong64": true, "linux/ppc64le": true,
+		"linux/riscv64": true, "linux/s390x": true,
+		"freebsd/amd64": true,
+	},
+	"c-shared": {
+		"linux/386": true, "linux/amd64": true, "linux/arm": true,
+		"linux/arm64": true, "linux/loong64": true, "linux/ppc64le": true,
+		"linux/riscv64": true, "linux/s390x": true,
+		"android/386": true, "android/amd64": true, "android/arm": true,
+		"android/arm64": true,
+		"freebsd/amd64": true,
+		"darwin/amd64":  true, "darwin/arm64": true,
+		"windows/386": true, "windows/amd64": true, "windows/arm64": true,
+		"wasip1/wasm": true,
+	},
+	"pie": {
+		"linux/386": true, "linux/amd64": true, "linux/arm": true,
+		"linux/arm64": true, "linux/loong64": true, "linux/ppc64le": true,
+		"linux/riscv64": true, "linux/s390x": true,
+		"android/386": true, "android/amd64": true, "android/arm": true,
+		"android/arm64": true,
+		"freebsd/amd64": true,
+		"darwin/amd64":  true, "darwin/arm64": true,
+		"ios/amd64": true, "ios/arm64": true,
+		"aix/ppc64":     true,
+		"openbsd/arm64": true,
+		"windows/386":   true, "windows/amd64": true, "windows/arm": true,
+		"windows/arm64": true,
+	},
+	"shared": {
+		"linux/386": true, "linux/amd64": true, "linux/arm": true,
+		"linux/arm64": true, "linux/ppc64le": true, "linux/s390x": true,
+	},
+	"plugin": {
+		"linux/386": true, "linux/amd64": true, "linux/arm": true,
+		"linux/arm64": true, "linux/loong64": true, "linux/ppc64le": true,
+		"linux/s390x": true,
+		"android/386": true, "android/amd64": true,
+		"darwin/amd64": true, "darwin/arm64": true,
+		"freebsd/amd64": true,
+	},
+}
+
+// RaceSupported returns true if the race detector is supported on the
+// platform.
+func RaceSupported(p Platform) bool {
+	return raceSupported[p.OSArch()]
+}
+
+// BuildmodeSupported returns true if the build mode is supported on the
+// platform, where an empty mode is "default". Unknown build modes aren't
+// supported anywhere.
+func BuildmodeSupported(mode string, p Platform) bool {
+	if mode == "" {
+		mode = "default"
+	}
+
+	platforms := buildmodeSupported[mode]
+	return platforms[p.OSArch()] || platforms[p.OS+"/*"] || platforms["*/*"]
+}
+
+// CheckSupported returns an error if the platform of opts doesn't support
+// the race detector, build mode or cgo as requested by opts, if the race
+// detector is requested without cgo, which it needs, or if Zig
+// can't cross-compile cgo for it when it is the cgo toolchain. cgo support
+// is only checked if hasCgo is true, as it is only known when the list of
+// platforms came from the toolchain, see CgoKnown.
+func CheckSupported(opts *CompileOpts, hasCgo bool) error {
+	p := opts.Platform
+
+	if opts.Race && !RaceSupported(p) {
+		return fmt.Errorf("-race is not supported on %s", p.OSArch())
+	}
+
+	// The race detector needs cgo, which is only enabled by default for
+	// the platform that gox runs on.
+	if opts.Race && !cgoEnabled(opts) {
+		return fmt.Errorf("-race requires cgo, which is disabled for %s", p.OSArch())
+	}
+
+	if _, ok := buildmodeSupported[opts.Buildmode]; opts.Buildmode != "" && !ok {
+		return fmt.Errorf("unknown -buildmode=%s", opts.Buildmode)
+	}
+
+	if opts.Buildmode != "" && !BuildmodeSupported(opts.Buildmode, p) {
+		return fmt.Errorf("-buildmode=%s is not supported on %s", opts.Buildmode, p.OSArch())
+	}
+
+	if opts.Cgo && hasCgo && !p.CgoSupported {
+		return fmt.Errorf("cgo is not supported on %s", p.OSArch())
+	}
+
+	if opts.Cgo && opts.CgoToolchain == "zig" {
+		if _, err := ZigTarget(p, opts.CgoLibc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CgoKnown returns true if the platforms include cgo support information,
+// which is only the case when they came from the toolchain.
+func CgoKnown(platforms []Platform) bool {
+	for _, p := range platforms {
+		if p.CgoSupported {
+			return true
+		}
+	}
+
+	return false
+}
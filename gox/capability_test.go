@@ -0,0 +1,59 @@
+package gox
+
+import (
+	"testing"
+)
+
+func TestBuildmodeSupported(t *testing.T) {
+	cases := []struct {
+		Mode     string
+		Platform Platform
+		Expected bool
+	}{
+		{"", Platform{OS: "plan9", Arch: "386"}, true},
+		{"exe", Platform{OS: "plan9", Arch: "386"}, true},
+		{"pie", Platform{OS: "linux", Arch: "amd64"}, true},
+		{"pie", Platform{OS: "linux", Arch: "mips"}, false},
+		{"c-archive", Platform{OS: "darwin", Arch: "arm64"}, true},
+		{"c-archive", Platform{OS: "openbsd", Arch: "amd64"}, false},
+		{"plugin", Platform{OS: "windows", Arch: "amd64"}, false},
+		{"pie", Platform{OS: "linux", Arch: "arm", Variant: "7"}, true},
+		{"archive", Platform{OS: "js", Arch: "wasm"}, true},
+		{"nope", Platform{OS: "linux", Arch: "amd64"}, false},
+	}
+
+	for _, tc := range cases {
+		if actual := BuildmodeSupported(tc.Mode, tc.Platform); actual != tc.Expected {
+			t.Fatalf("bad: %s %s: %v", tc.Mode, tc.Platform.String(), actual)
+		}
+	}
+}
+
+func TestCheckSupported(t *testing.T) {
+	linux := Platform{OS: "linux", Arch: "amd64", CgoSupported: true}
+	js := Platform{OS: "js", Arch: "wasm"}
+
+	cases := []struct {
+		Opts     CompileOpts
+		CgoKnown bool
+		Err      bool
+	}{
+		{CompileOpts{Platform: linux, Race: true, Cgo: true}, true, false},
+		{CompileOpts{Platform: js, Race: true}, true, true},
+		{CompileOpts{Platform: js, Buildmode: "pie"}, true, true},
+		{CompileOpts{Platform: js, Cgo: true}, true, true},
+		{CompileOpts{Platform: js, Cgo: true}, false, false},
+		{CompileOpts{Platform: js}, true, false},
+		{CompileOpts{Platform: linux, Buildmode: "nope"}, true, true},
+		{CompileOpts{Platform: linux, Race: true, DisableCgo: true}, true, true},
+		{CompileOpts{Platform: linux, Race: true, Cgo: true, Env: []string{"CGO_ENABLED=0"}}, true, true},
+		{CompileOpts{Platform: Platform{OS: "darwin", Arch: "arm64"}, Race: true, Env: []string{"CGO_ENABLED=1"}}, true, false},
+	}
+
+	for _, tc := range cases {
+		err := CheckSupported(&tc.Opts, tc.CgoKnown)
+		if (err != nil) != tc.Err {
+			t.Fatalf("bad: %#v: %v", tc.Opts, err)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package gox
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// ChecksumAlgorithms are the supported checksum algorithms. blake2b is
+// BLAKE2b-512, which is what b2sum uses.
+var ChecksumAlgorithms = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+	"blake2b": func() hash.Hash {
+		h, _ := blake2b.New512(nil)
+		return h
+	},
+}
+
+// ChecksumFile returns the hex encoded checksum of the file at path using
+// the given algorithm.
+func ChecksumFile(path string, algo string) (string, error) {
+	newHash, ok := ChecksumAlgorithms[algo]
+	if !ok {
+		return "", fmt.Errorf("unknown checksum algorithm: %s", algo)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := newHash()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ChecksumOpts are the options for writing the checksums of artifacts.
+type ChecksumOpts struct {
+	// Algorithm is one of "sha256", "sha512" or "blake2b".
+	Algorithm string
+
+	// Output is the path of the checksum file covering every artifact. If
+	// it's empty then no checksum file is written.
+	Output string
+
+	// Sidecar writes a "<artifact>.<algorithm>" file next to each artifact
+	// containing only the checksum of that artifact.
+	Sidecar bool
+}
+
+// WriteChecksums writes the checksums of the artifacts in the format used
+// by sha256sum and friends, so they can be verified with `sha256sum -c`.
+// The paths in the checksum file are relative to the directory it is in.
+func WriteChecksums(opts *ChecksumOpts, artifacts []string) error {
+	output := ""
+	if opts.Output != "" {
+		var err error
+		if output, err = filepath.Abs(opts.Output); err != nil {
+			return err
+		}
+	}
+
+	lines := make([]string, 0, len(artifacts))
+	for _, artifact := range artifacts {
+		sum, err := ChecksumFile(artifact, opts.Algorithm)
+		if err != nil {
+			return err
+		}
+
+		if opts.Sidecar {
+			line := fmt.Sprintf("%s  %s\n", sum, filepath.Base(artifact))
+			if err := os.WriteFile(artifact+"."+opts.Algorithm, []byte(line), 0644); err != nil {
+				return err
+			}
+		}
+
+		if output == "" {
+			continue
+		}
+
+		name, err := filepath.Rel(filepath.Dir(output), artifact)
+		if err != nil {
+			return err
+		}
+
+		lines = append(lines, fmt.Sprintf("%s  %s\n", sum, filepath.ToSlash(name)))
+	}
+
+	if output == "" {
+		return nil
+	}
+
+	// Sort by name rather than by checksum so the file is easy to read.
+	sort.Slice(lines, func(i, j int) bool {
+		return lines[i][strings.Index(lines[i], "  "):] < lines[j][strings.Index(lines[j], "  "):]
+	})
+
+	return os.WriteFile(output, []byte(strings.Join(lines, "")), 0644)
+}
@@ -0,0 +1,82 @@
+package gox
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChecksumFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "foo")
+	if err := os.WriteFile(path, []byte("hello\n"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cases := []struct {
+		Algorithm string
+		Sum       string
+	}{
+		{"sha256", "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"},
+		{"sha512", "e7c22b994c59d9cf2b48e549b1e24666636045930d3da7c1acb299d1c3b7f931f94aae41edda2c2b207a36e10f8bcb8d45223e54878f5b316e7ce3b6bc019629"},
+		{"blake2b", "f60ce482e5cc1229f39d71313171a8d9f4ca3a87d066bf4b205effb528192a75f14f3271e2c1a90e1de53f275b4d4793eef2f5e31ea90d2ce29d2e481c36435f"},
+	}
+
+	for _, tc := range cases {
+		sum, err := ChecksumFile(path, tc.Algorithm)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if sum != tc.Sum {
+			t.Fatalf("%s: bad: %s", tc.Algorithm, sum)
+		}
+	}
+
+	if _, err := ChecksumFile(path, "md5"); err == nil {
+		t.Fatal("should err")
+	}
+}
+
+func TestWriteChecksums(t *testing.T) {
+	td := t.TempDir()
+
+	artifacts := []string{
+		filepath.Join(td, "pkg", "foo_windows_amd64.exe"),
+		filepath.Join(td, "pkg", "foo_linux_amd64"),
+	}
+	for _, path := range artifacts {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := os.WriteFile(path, []byte("hello\n"), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	opts := &ChecksumOpts{
+		Algorithm: "sha256",
+		Output:    filepath.Join(td, "SHA256SUMS"),
+		Sidecar:   true,
+	}
+	if err := WriteChecksums(opts, artifacts); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	sum := "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+
+	data, err := os.ReadFile(opts.Output)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := sum + "  pkg/foo_linux_amd64\n" + sum + "  pkg/foo_windows_amd64.exe\n"
+	if string(data) != expected {
+		t.Fatalf("bad: %s", data)
+	}
+
+	data, err = os.ReadFile(artifacts[1] + ".sha256")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(data) != sum+"  foo_linux_amd64\n" {
+		t.Fatalf("bad: %s", data)
+	}
+}
@@ -0,0 +1,553 @@
+package gox
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"debug/macho"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The parts of a code signature, see cmd/internal/codesign in Go.
+const (
+	lcCodeSignature = 0x1d
+
+	csMagicRequirements      = 0xfade0c01
+	csMagicCodeDirectory     = 0xfade0c02
+	csMagicEmbeddedSignature = 0xfade0cc0
+	csMagicEntitlements      = 0xfade7171
+	csMagicEntitlementsDER   = 0xfade7172
+
+	csSlotCodeDirectory   = 0
+	csSlotRequirements    = 2
+	csSlotEntitlements    = 5
+	csSlotEntitlementsDER = 7
+
+	csAdhoc             = 0x2
+	csExecSegMainBinary = 0x1
+	csHashTypeSHA256    = 2
+
+	csPageSizeBits   = 12
+	csPageSize       = 1 << csPageSizeBits
+	csCodeDirHeader  = 88
+	csCodeDirVersion = 0x20400
+)
+
+// machoSignature is what is needed from a 64-bit Mach-O file to sign it.
+type machoSignature struct {
+	file *macho.File
+
+	// sigCmd is the offset of the LC_CODE_SIGNATURE load command, or zero
+	// if there is none, and sigOffset and sigSize the location of the
+	// signature it points to.
+	sigCmd    int
+	sigOffset uint32
+	sigSize   uint32
+
+	// linkeditCmd is the offset of the load command of the __LINKEDIT
+	// segment, which the signature is at the end of.
+	linkeditCmd int
+	linkedit    *macho.Segment
+	text        *macho.Segment
+}
+
+func parseMachoSignature(data []byte) (*machoSignature, error) {
+	f, err := macho.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if f.Magic != macho.Magic64 {
+		return nil, fmt.Errorf("not a 64-bit Mach-O binary")
+	}
+
+	m := &machoSignature{file: f}
+	offset := 32
+	for _, l := range f.Loads {
+		raw := l.Raw()
+		switch f.ByteOrder.Uint32(raw) {
+		case lcCodeSignature:
+			m.sigCmd = offset
+			m.sigOffset = f.ByteOrder.Uint32(raw[8:])
+			m.sigSize = f.ByteOrder.Uint32(raw[12:])
+		}
+
+		if seg, ok := l.(*macho.Segment); ok {
+			switch seg.Name {
+			case "__LINKEDIT":
+				m.linkeditCmd = offset
+				m.linkedit = seg
+			case "__TEXT":
+				m.text = seg
+			}
+		}
+
+		offset += len(raw)
+	}
+
+	if m.linkedit == nil || m.text == nil {
+		return nil, fmt.Errorf("no __TEXT or __LINKEDIT segment")
+	}
+
+	return m, nil
+}
+
+// CodesignAdhoc signs the 64-bit Mach-O binary at path with an ad-hoc code
+// signature, which is what arm64 Macs need to run it, replacing any it has
+// already. The signature has the identifier and, if not empty, the
+// entitlements, an XML property list, both as it is and in the DER form
+// that newer versions of macOS check. It's like "codesign -s -" but works
+// on any OS.
+func CodesignAdhoc(path string, identifier string, entitlements []byte) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	m, err := parseMachoSignature(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	bo := m.file.ByteOrder
+
+	// The signature replaces the one at the end of the file, or is added
+	// after it with a new load command in the padding after the others.
+	linkeditEnd := m.linkedit.Offset + m.linkedit.Filesz
+	if m.sigCmd != 0 {
+		if uint64(m.sigOffset)+uint64(m.sigSize) != linkeditEnd || linkeditEnd != uint64(len(data)) {
+			return fmt.Errorf("%s: the code signature isn't at the end of the file", path)
+		}
+		data = data[:m.sigOffset]
+	} else {
+		if linkeditEnd != uint64(len(data)) {
+			return fmt.Errorf("%s: __LINKEDIT isn't at the end of the file", path)
+		}
+
+		m.sigCmd = 32 + int(m.file.Cmdsz)
+		for _, s := range m.file.Sections {
+			if s.Offset != 0 && m.sigCmd+16 > int(s.Offset) {
+				return fmt.Errorf("%s: no room for the code signature load command", path)
+			}
+		}
+
+		bo.PutUint32(data[16:], m.file.Ncmd+1)
+		bo.PutUint32(data[20:], m.file.Cmdsz+16)
+		bo.PutUint32(data[m.sigCmd:], lcCodeSignature)
+		bo.PutUint32(data[m.sigCmd+4:], 16)
+		data = append(data, make([]byte, (16-len(data)%16)%16)...)
+	}
+
+	codeLimit := len(data)
+	if uint64(codeLimit) > 1<<32-1 {
+		return fmt.Errorf("%s: too large to sign", path)
+	}
+
+	var der []byte
+	if len(entitlements) > 0 {
+		if der, err = entitlementsDER(entitlements); err != nil {
+			return err
+		}
+	}
+
+	// The blobs of the signature, other than the code directory, and the
+	// special slots of their hashes in it.
+	blobs := map[uint32][]byte{
+		csSlotRequirements: csBlob(csMagicRequirements, []byte{0, 0, 0, 0}),
+	}
+	specialSlots := csSlotRequirements
+	if len(entitlements) > 0 {
+		blobs[csSlotEntitlements] = csBlob(csMagicEntitlements, entitlements)
+		blobs[csSlotEntitlementsDER] = csBlob(csMagicEntitlementsDER, der)
+		specialSlots = csSlotEntitlementsDER
+	}
+
+	codeSlots := (codeLimit + csPageSize - 1) / csPageSize
+	hashOffset := csCodeDirHeader + len(identifier) + 1 + specialSlots*sha256.Size
+	codeDirSize := hashOffset + codeSlots*sha256.Size
+
+	types := []uint32{csSlotCodeDirectory, csSlotRequirements}
+	if len(entitlements) > 0 {
+		types = append(types, csSlotEntitlements, csSlotEntitlementsDER)
+	}
+	sigSize := 12 + 8*len(types) + codeDirSize
+	for _, blob := range blobs {
+		sigSize += len(blob)
+	}
+
+	// Point to the signature before hashing, since the load commands are
+	// part of what is signed.
+	bo.PutUint32(data[m.sigCmd+8:], uint32(codeLimit))
+	bo.PutUint32(data[m.sigCmd+12:], uint32(sigSize))
+	filesz := uint64(codeLimit+sigSize) - m.linkedit.Offset
+	memsz := (filesz + 0x3fff) &^ 0x3fff
+	if memsz < m.linkedit.Memsz {
+		memsz = m.linkedit.Memsz
+	}
+	bo.PutUint64(data[m.linkeditCmd+32:], memsz)
+	bo.PutUint64(data[m.linkeditCmd+48:], filesz)
+
+	// The code directory is big-endian, like the rest of the signature.
+	be := binary.BigEndian
+	cd := make([]byte, 0, codeDirSize)
+	cd = be.AppendUint32(cd, csMagicCodeDirectory)
+	cd = be.AppendUint32(cd, uint32(codeDirSize))
+	cd = be.AppendUint32(cd, csCodeDirVersion)
+	cd = be.AppendUint32(cd, csAdhoc)
+	cd = be.AppendUint32(cd, uint32(hashOffset))
+	cd = be.AppendUint32(cd, csCodeDirHeader)
+	cd = be.AppendUint32(cd, uint32(specialSlots))
+	cd = be.AppendUint32(cd, uint32(codeSlots))
+	cd = be.AppendUint32(cd, uint32(codeLimit))
+	cd = append(cd, sha256.Size, csHashTypeSHA256, 0, csPageSizeBits)
+	cd = append(cd, make([]byte, 4+4+4+4+8)...) // spare2, scatter, team, spare3, codeLimit64
+	cd = be.AppendUint64(cd, m.text.Offset)
+	cd = be.AppendUint64(cd, m.text.Filesz)
+	var execSegFlags uint64
+	if m.file.Type == macho.TypeExec {
+		execSegFlags = csExecSegMainBinary
+	}
+	cd = be.AppendUint64(cd, execSegFlags)
+	cd = append(cd, identifier...)
+	cd = append(cd, 0)
+
+	// The special slots are in reverse order before the code slots.
+	for slot := specialSlots; slot > 0; slot-- {
+		hash := make([]byte, sha256.Size)
+		if blob, ok := blobs[uint32(slot)]; ok {
+			sum := sha256.Sum256(blob)
+			hash = sum[:]
+		}
+		cd = append(cd, hash...)
+	}
+	for page := 0; page < codeLimit; page += csPageSize {
+		sum := sha256.Sum256(data[page:min(page+csPageSize, codeLimit)])
+		cd = append(cd, sum[:]...)
+	}
+
+	sig := make([]byte, 0, sigSize)
+	sig = be.AppendUint32(sig, csMagicEmbeddedSignature)
+	sig = be.AppendUint32(sig, uint32(sigSize))
+	sig = be.AppendUint32(sig, uint32(len(types)))
+	offset := 12 + 8*len(types)
+	for _, typ := range types {
+		sig = be.AppendUint32(sig, typ)
+		sig = be.AppendUint32(sig, uint32(offset))
+		if typ == csSlotCodeDirectory {
+			offset += len(cd)
+		} else {
+			offset += len(blobs[typ])
+		}
+	}
+	sig = append(sig, cd...)
+	for _, typ := range types[1:] {
+		sig = append(sig, blobs[typ]...)
+	}
+
+	return os.WriteFile(path, append(data, sig...), 0755)
+}
+
+// csBlob returns a blob of the signature, with its magic and length.
+func csBlob(magic uint32, data []byte) []byte {
+	blob := binary.BigEndian.AppendUint32(nil, magic)
+	blob = binary.BigEndian.AppendUint32(blob, uint32(8+len(data)))
+	return append(blob, data...)
+}
+
+// VerifyCodeSignature returns an error unless the 64-bit Mach-O binary at
+// path has a code signature whose hashes match its content.
+func VerifyCodeSignature(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	m, err := parseMachoSignature(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if m.sigCmd == 0 {
+		return fmt.Errorf("%s: no code signature", path)
+	}
+
+	errInvalid := fmt.Errorf("%s: invalid code signature", path)
+	if uint64(m.sigOffset)+uint64(m.sigSize) > uint64(len(data)) || m.sigSize < 12 {
+		return errInvalid
+	}
+	sig := data[m.sigOffset : m.sigOffset+m.sigSize]
+
+	be := binary.BigEndian
+	if be.Uint32(sig) != csMagicEmbeddedSignature {
+		return errInvalid
+	}
+
+	blobs := make(map[uint32][]byte)
+	count := int(be.Uint32(sig[8:]))
+	if 12+8*count > len(sig) {
+		return errInvalid
+	}
+	for i := 0; i < count; i++ {
+		typ := be.Uint32(sig[12+8*i:])
+		offset := be.Uint32(sig[16+8*i:])
+		if uint64(offset)+8 > uint64(len(sig)) {
+			return errInvalid
+		}
+
+		length := be.Uint32(sig[offset+4:])
+		if uint64(offset)+uint64(length) > uint64(len(sig)) {
+			return errInvalid
+		}
+		blobs[typ] = sig[offset : offset+length]
+	}
+
+	cd, ok := blobs[csSlotCodeDirectory]
+	if !ok || len(cd) < csCodeDirHeader || be.Uint32(cd) != csMagicCodeDirectory {
+		return errInvalid
+	}
+	if cd[37] != csHashTypeSHA256 || cd[39] != csPageSizeBits {
+		return fmt.Errorf("%s: unsupported code signature", path)
+	}
+
+	hashOffset := int(be.Uint32(cd[16:]))
+	specialSlots := int(be.Uint32(cd[24:]))
+	codeSlots := int(be.Uint32(cd[28:]))
+	codeLimit := int(be.Uint32(cd[32:]))
+	if codeLimit != int(m.sigOffset) || hashOffset < specialSlots*sha256.Size ||
+		hashOffset+codeSlots*sha256.Size > len(cd) || codeSlots != (codeLimit+csPageSize-1)/csPageSize {
+		return errInvalid
+	}
+
+	for slot := 1; slot <= specialSlots; slot++ {
+		blob, ok := blobs[uint32(slot)]
+		if !ok {
+			continue
+		}
+
+		sum := sha256.Sum256(blob)
+		if !bytes.Equal(cd[hashOffset-slot*sha256.Size:hashOffset-(slot-1)*sha256.Size], sum[:]) {
+			return fmt.Errorf("%s: code signature doesn't match slot %d", path, slot)
+		}
+	}
+
+	for i := 0; i < codeSlots; i++ {
+		page := i * csPageSize
+		sum := sha256.Sum256(data[page:min(page+csPageSize, codeLimit)])
+		if !bytes.Equal(cd[hashOffset+i*sha256.Size:hashOffset+(i+1)*sha256.Size], sum[:]) {
+			return fmt.Errorf("%s: code signature doesn't match page %d", path, i)
+		}
+	}
+
+	return nil
+}
+
+// parsePlist returns the value of the XML property list: a
+// map[string]any for a dict, an []any for an array, a string, a bool or
+// an int64. Other types can't be entitlements, so they aren't supported.
+func parsePlist(data []byte) (any, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	start, err := plistNext(d)
+	if err != nil {
+		return nil, err
+	}
+	if start == nil || start.Name.Local != "plist" {
+		return nil, fmt.Errorf("not an XML property list")
+	}
+
+	start, err = plistNext(d)
+	if err != nil {
+		return nil, err
+	}
+	if start == nil {
+		return nil, fmt.Errorf("empty property list")
+	}
+
+	return plistValue(d, start)
+}
+
+// plistNext returns the next start element, or nil at an end element.
+func plistNext(d *xml.Decoder) (*xml.StartElement, error) {
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := t.(type) {
+		case xml.StartElement:
+			return &t, nil
+		case xml.EndElement:
+			return nil, nil
+		}
+	}
+}
+
+func plistValue(d *xml.Decoder, start *xml.StartElement) (any, error) {
+	switch start.Name.Local {
+	case "dict":
+		dict := make(map[string]any)
+		for {
+			key, err := plistNext(d)
+			if err != nil || key == nil {
+				return dict, err
+			}
+
+			if key.Name.Local != "key" {
+				return nil, fmt.Errorf("<%s> in a dict instead of a <key>", key.Name.Local)
+			}
+			var name string
+			if err := d.DecodeElement(&name, key); err != nil {
+				return nil, err
+			}
+
+			value, err := plistNext(d)
+			if err != nil {
+				return nil, err
+			}
+			if value == nil {
+				return nil, fmt.Errorf("no value for the key %q", name)
+			}
+			if dict[name], err = plistValue(d, value); err != nil {
+				return nil, err
+			}
+		}
+
+	case "array":
+		array := make([]any, 0)
+		for {
+			value, err := plistNext(d)
+			if err != nil || value == nil {
+				return array, err
+			}
+
+			v, err := plistValue(d, value)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, v)
+		}
+
+	case "string", "integer":
+		var text string
+		if err := d.DecodeElement(&text, start); err != nil {
+			return nil, err
+		}
+		if start.Name.Local == "string" {
+			return text, nil
+		}
+		return strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+
+	case "true", "false":
+		return start.Name.Local == "true", d.Skip()
+	}
+
+	return nil, fmt.Errorf("<%s> isn't supported in entitlements", start.Name.Local)
+}
+
+// entitlementsDER returns the DER form of the entitlements property list,
+// as codesign writes it: the version, 1, and the dict, with the keys of
+// every dict in order.
+func entitlementsDER(entitlements []byte) ([]byte, error) {
+	v, err := parsePlist(entitlements)
+	if err != nil {
+		return nil, fmt.Errorf("entitlements: %w", err)
+	}
+	if _, ok := v.(map[string]any); !ok {
+		return nil, fmt.Errorf("entitlements aren't a dict")
+	}
+
+	version, err := asn1.Marshal(1)
+	if err != nil {
+		return nil, err
+	}
+	dict, err := derValue(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(asn1.RawValue{Class: asn1.ClassApplication, Tag: 16, IsCompound: true, Bytes: append(version, dict...)})
+}
+
+// derValue returns the DER form of a value of a property list. A dict is
+// a context-specific set of sequences of the key and the value.
+func derValue(v any) ([]byte, error) {
+	switch v := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		var content []byte
+		for _, k := range keys {
+			key, err := derValue(k)
+			if err != nil {
+				return nil, err
+			}
+			value, err := derValue(v[k])
+			if err != nil {
+				return nil, err
+			}
+
+			entry, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: append(key, value...)})
+			if err != nil {
+				return nil, err
+			}
+			content = append(content, entry...)
+		}
+		return asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 16, IsCompound: true, Bytes: content})
+
+	case []any:
+		var content []byte
+		for _, e := range v {
+			value, err := derValue(e)
+			if err != nil {
+				return nil, err
+			}
+			content = append(content, value...)
+		}
+		return asn1.Marshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: content})
+
+	case string:
+		return asn1.Marshal(asn1.RawValue{Tag: asn1.TagUTF8String, Bytes: []byte(v)})
+	}
+
+	return asn1.Marshal(v)
+}
+
+// readEntitlements returns the entitlements property list at path.
+func readEntitlements(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := entitlementsDER(data); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return data, nil
+}
+
+// codesign signs the binary of the job at output, with the name of the
+// file as the identifier like codesign, and checks the signature.
+func (b *Builder) codesign(job *Job, output string) error {
+	var entitlements []byte
+	if b.Entitlements != "" {
+		var err error
+		if entitlements, err = readEntitlements(b.Entitlements); err != nil {
+			return err
+		}
+	}
+
+	if err := CodesignAdhoc(output, filepath.Base(output), entitlements); err != nil {
+		return err
+	}
+
+	return VerifyCodeSignature(output)
+}
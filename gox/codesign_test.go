@@ -0,0 +1,140 @@
+package gox
+
+import (
+	"bytes"
+	"context"
+	"debug/macho"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testEntitlements = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>com.apple.security.network.client</key>
+	<true/>
+</dict>
+</plist>
+`
+
+func TestBuilder_codesign(t *testing.T) {
+	td := testModule(t, map[string]string{"app.entitlements": testEntitlements})
+	b := &Builder{Parallel: 2, Codesign: true, Entitlements: "app.entitlements"}
+	platforms := []Platform{
+		{OS: "darwin", Arch: "amd64"},
+		{OS: "darwin", Arch: "arm64"},
+	}
+	jobs, err := b.Plan([]string{"example.com/app"}, platforms, func(pkg string, platform Platform) (*CompileOpts, error) {
+		return &CompileOpts{
+			PackagePath: pkg,
+			Platform:    platform,
+			OutputTpl:   filepath.Join(td, DefaultOutputTpl),
+			GoCmd:       "go",
+			Ldflags:     "-s -w",
+		}, nil
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for _, r := range b.Build(context.Background(), jobs) {
+		if r.Err != nil {
+			t.Fatalf("%s: %s", r.Job.Platform.String(), r.Err)
+		}
+
+		path := r.Artifacts[0].Path
+		if err := VerifyCodeSignature(path); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		der, err := entitlementsDER([]byte(testEntitlements))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if !bytes.Contains(data, []byte(testEntitlements)) || !bytes.Contains(data, der) || !bytes.Contains(data, []byte("app_darwin_"+r.Job.Platform.Arch+"\x00")) {
+			t.Fatalf("bad: %s: no entitlements or identifier", r.Job.Platform.String())
+		}
+
+		f, err := macho.Open(path)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		linkedit := f.Segment("__LINKEDIT")
+		f.Close()
+		if linkedit.Offset+linkedit.Filesz != uint64(len(data)) {
+			t.Fatalf("bad: %#v", linkedit.SegmentHeader)
+		}
+
+		// Signing again replaces the signature.
+		if err := CodesignAdhoc(path, "app", nil); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := VerifyCodeSignature(path); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		// Changing the code breaks the signature.
+		data, err = os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		binary.BigEndian.PutUint32(data[4096:], 0xdeadbeef)
+		if err := os.WriteFile(path, data, 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := VerifyCodeSignature(path); err == nil {
+			t.Fatalf("%s: expected error", r.Job.Platform.String())
+		}
+	}
+}
+
+func TestBuilder_codesignEntitlements(t *testing.T) {
+	td := t.TempDir()
+	path := filepath.Join(td, "app.entitlements")
+	if err := os.WriteFile(path, []byte("{}"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	b := &Builder{Codesign: true, Entitlements: path}
+	if _, err := b.Plan([]string{"."}, []Platform{{OS: "darwin", Arch: "arm64"}}, nil); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestEntitlementsDER(t *testing.T) {
+	plist := func(dict string) []byte {
+		return []byte(`<?xml version="1.0" encoding="UTF-8"?><plist version="1.0">` + dict + `</plist>`)
+	}
+
+	cases := []struct {
+		Input    []byte
+		Expected string
+	}{
+		{
+			[]byte(testEntitlements),
+			"702d020101b0283026" + "0c21" + hex.EncodeToString([]byte("com.apple.security.network.client")) + "0101ff",
+		},
+		{
+			plist(`<dict><key>c</key><false/><key>a</key><array><string>b</string><integer>1</integer></array></dict>`),
+			"701a020101b015300b0c0161" + "30060c0162020101" + "30060c0163010100",
+		},
+		{plist(`<dict><key>a</key><real>1.5</real></dict>`), ""},
+		{plist(`<array/>`), ""},
+		{[]byte("{}"), ""},
+	}
+
+	for i, tc := range cases {
+		der, err := entitlementsDER(tc.Input)
+		if (err != nil) != (tc.Expected == "") || hex.EncodeToString(der) != tc.Expected {
+			t.Fatalf("%d: bad: %x %v", i, der, err)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package gox
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// OverrideLevels returns the levels at which options can be overridden for
+// the platform, from the lowest precedence to the highest: the OS, the
+// arch, the os/arch pair and, for platforms with one, the variant.
+func OverrideLevels(platform Platform) [][]string {
+	levels := [][]string{
+		{platform.OS},
+		{platform.Arch},
+		{platform.OS, platform.Arch},
+	}
+	if platform.Variant != "" {
+		levels = append(levels, []string{platform.OS, platform.Arch, platform.Variant})
+	}
+
+	return levels
+}
+
+// envNameRe matches the characters that aren't allowed in the names of
+// environment variables, such as the comma in the "7,softfloat" variant.
+var envNameRe = regexp.MustCompile("[^A-Z0-9_]")
+
+// ApplyOverrides applies the overrides for the platform of opts, level by
+// level from the lowest precedence to the highest, see OverrideLevels. At
+// each level those of config, if it isn't nil, are applied first and then
+// those of the environment, so that the environment only takes precedence
+// at the same level and an override for a more specific level always wins.
+func ApplyOverrides(opts *CompileOpts, config func(opts *CompileOpts, level []string) error) error {
+	for _, level := range OverrideLevels(opts.Platform) {
+		if config != nil {
+			if err := config(opts, level); err != nil {
+				return err
+			}
+		}
+
+		if err := envOverrides(opts, level); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// EnvOverrides applies the overrides from the environment to opts. The
+// environment variables are in the format of GOX_{LEVEL}_{KEY}, where the
+// level is one of {OS}, {ARCH}, {OS}_{ARCH} or {OS}_{ARCH}_{VARIANT}, and
+// GOX_{LEVEL}_ENV_{NAME} sets the environment variable NAME for the build.
+func EnvOverrides(opts *CompileOpts) error {
+	return ApplyOverrides(opts, nil)
+}
+
+// envOverrides applies the overrides from the environment for a single
+// level.
+func envOverrides(opts *CompileOpts, level []string) error {
+	prefix := "GOX_" + envNameRe.ReplaceAllString(
+		strings.ToUpper(strings.Join(level, "_")), "_") + "_"
+
+	for _, key := range OverrideKeys {
+		if v := os.Getenv(prefix + key); v != "" {
+			if err := ApplyOverride(opts, key, v); err != nil {
+				return fmt.Errorf("%s%s: %s", prefix, key, err)
+			}
+		}
+	}
+
+	for _, kv := range os.Environ() {
+		name, v, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(name, prefix+"ENV_") || v == "" {
+			continue
+		}
+
+		OverrideEnv(opts, strings.TrimPrefix(name, prefix+"ENV_"), v)
+	}
+
+	return nil
+}
+
+// OverrideKeys are the keys of the options that can be overridden.
+var OverrideKeys = []string{
+	"LDFLAGS",
+	"GCFLAGS",
+	"ASMFLAGS",
+	"TAGS",
+	"BUILDMODE",
+	"TRIMPATH",
+	"OUTPUT",
+	"CGO_ENABLED",
+	"CGO_CFLAGS",
+	"CGO_LDFLAGS",
+	"CC",
+	"CXX",
+	"MAX_SIZE",
+}
+
+// ApplyOverride overrides the option for key with value. If value starts
+// with "+" then the rest of it is appended to the current value, separated
+// by a space, instead of replacing it.
+func ApplyOverride(opts *CompileOpts, key string, value string) error {
+	var target *string
+	switch key {
+	case "LDFLAGS":
+		target = &opts.Ldflags
+	case "GCFLAGS":
+		target = &opts.Gcflags
+	case "ASMFLAGS":
+		target = &opts.Asmflags
+	case "TAGS":
+		target = &opts.Tags
+	case "BUILDMODE":
+		target = &opts.Buildmode
+	case "OUTPUT":
+		target = &opts.OutputTpl
+	case "CGO_CFLAGS":
+		target = &opts.CgoCflags
+	case "CGO_LDFLAGS":
+		target = &opts.CgoLdflags
+	case "CC":
+		target = &opts.Cc
+	case "CXX":
+		target = &opts.Cxx
+	case "TRIMPATH":
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+
+		opts.TrimPath = v
+		return nil
+	case "MAX_SIZE":
+		v, err := ParseSize(value)
+		if err != nil {
+			return err
+		}
+
+		opts.MaxSize = v
+		return nil
+	case "CGO_ENABLED":
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+
+		opts.Cgo = v
+		opts.DisableCgo = !v
+		return nil
+	default:
+		return fmt.Errorf("unknown override %s", key)
+	}
+
+	if strings.HasPrefix(value, "+") {
+		value = strings.TrimSpace(*target + " " + value[1:])
+	}
+
+	*target = value
+	return nil
+}
+
+// OverrideEnv sets the environment variable name to value for the build,
+// replacing any previous override of it.
+func OverrideEnv(opts *CompileOpts, name string, value string) {
+	for i, kv := range opts.Env {
+		if strings.HasPrefix(kv, name+"=") {
+			opts.Env[i] = name + "=" + value
+			return
+		}
+	}
+
+	opts.Env = append(opts.Env, name+"="+value)
+}
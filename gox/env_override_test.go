@@ -0,0 +1,76 @@
+package gox
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEnvOverrides(t *testing.T) {
+	t.Setenv("GOX_LINUX_LDFLAGS", "-s")
+	t.Setenv("GOX_ARM_LDFLAGS", "+-w")
+	t.Setenv("GOX_LINUX_ARM_LDFLAGS", "+-X main.arm=1")
+	t.Setenv("GOX_LINUX_ARM_7_SOFTFLOAT_TAGS", "soft")
+	t.Setenv("GOX_LINUX_TAGS", "netgo")
+	t.Setenv("GOX_ARM_CGO_ENABLED", "0")
+	t.Setenv("GOX_LINUX_ARM_CC", "arm-linux-gnueabihf-gcc")
+	t.Setenv("GOX_LINUX_ENV_PKG_CONFIG_PATH", "/usr/lib/pkgconfig")
+	t.Setenv("GOX_LINUX_ARM_ENV_PKG_CONFIG_PATH", "/usr/lib/arm-linux-gnueabihf/pkgconfig")
+	t.Setenv("GOX_WINDOWS_LDFLAGS", "-H windowsgui")
+
+	opts := &CompileOpts{
+		Platform: Platform{OS: "linux", Arch: "arm", Variant: "7,softfloat"},
+		Ldflags:  "-X main.version=1",
+		Cgo:      true,
+	}
+	if err := EnvOverrides(opts); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := &CompileOpts{
+		Platform:   opts.Platform,
+		Ldflags:    "-s -w -X main.arm=1",
+		Tags:       "soft",
+		Cc:         "arm-linux-gnueabihf-gcc",
+		DisableCgo: true,
+		Env:        []string{"PKG_CONFIG_PATH=/usr/lib/arm-linux-gnueabihf/pkgconfig"},
+	}
+	if !reflect.DeepEqual(opts, expected) {
+		t.Fatalf("bad: %#v", opts)
+	}
+
+	t.Setenv("GOX_LINUX_TRIMPATH", "maybe")
+	if err := EnvOverrides(&CompileOpts{Platform: Platform{OS: "linux", Arch: "amd64"}}); err == nil {
+		t.Fatal("should err")
+	}
+}
+
+func TestApplyOverride(t *testing.T) {
+	opts := &CompileOpts{Tags: "netgo"}
+
+	if err := ApplyOverride(opts, "TAGS", "+osusergo"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := ApplyOverride(opts, "OUTPUT", "dist/{{.OS}}"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := ApplyOverride(opts, "TRIMPATH", "true"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := ApplyOverride(opts, "CGO_LDFLAGS", "+-lm"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := &CompileOpts{
+		Tags:       "netgo osusergo",
+		OutputTpl:  "dist/{{.OS}}",
+		TrimPath:   true,
+		CgoLdflags: "-lm",
+	}
+	if !reflect.DeepEqual(opts, expected) {
+		t.Fatalf("bad: %#v", opts)
+	}
+
+	if err := ApplyOverride(opts, "FOO", "bar"); err == nil {
+		t.Fatal("should err")
+	}
+}
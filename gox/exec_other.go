@@ -0,0 +1,12 @@
+//go:build !unix
+
+package gox
+
+import (
+	"os/exec"
+)
+
+// killProcessGroup is a no-op on platforms without process groups, where
+// the default of killing only the go command when the context is done is
+// used.
+func killProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package gox
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killProcessGroup starts cmd in its own process group and, when its
+// context is done, kills the whole group so that the children of go build
+// (compile, link, cgo, ...) aren't orphaned.
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,1321 @@
+package gox
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"container/heap"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GitInfo is the version information of a git repository.
+type GitInfo struct {
+	// Version is like the output of "git describe --tags --always
+	// --dirty": the tag of the commit, the nearest tag followed by the
+	// number of commits since and the short commit, or just the short
+	// commit if there are no tags. It ends with "-dirty" if the working
+	// tree has changes.
+	Version string
+
+	// Tag is the nearest tag, or empty if there are none.
+	Tag string
+
+	Commit      string
+	ShortCommit string
+
+	// Dirty is true if the working tree or the index differ from the
+	// commit.
+	Dirty bool
+
+	// CommitDate is the date of the commit, in RFC 3339 format and UTC.
+	CommitDate string
+}
+
+// GitFields are the names of the fields of GitInfo for GitInfo.Field.
+var GitFields = []string{"version", "tag", "commit", "short-commit", "dirty", "commit-date"}
+
+// ParseStamp returns the symbols to set to the fields of the version
+// information, see CompileOpts.Stamp, from values such as
+// "main.version=version".
+func ParseStamp(values []string) (map[string]string, error) {
+	stamp := make(map[string]string, len(values))
+	for _, v := range values {
+		symbol, field, ok := strings.Cut(v, "=")
+		if _, known := (&GitInfo{}).Field(field); !ok || symbol == "" || !known {
+			return nil, fmt.Errorf("invalid stamp %q, should be symbol=field with a field of: %s",
+				v, strings.Join(GitFields, ", "))
+		}
+
+		stamp[symbol] = field
+	}
+
+	return stamp, nil
+}
+
+// gitTemplateFields matches the fields of GitInfo in a template.
+var gitTemplateFields = regexp.MustCompile(`\.(Version|Tag|Commit|ShortCommit|Dirty|CommitDate)\b`)
+
+// UsesGitInfo returns true if any of the templates uses a field of
+// GitInfo, so that the version information has to be read for them.
+func UsesGitInfo(templates ...string) bool {
+	for _, text := range templates {
+		if gitTemplateFields.MatchString(text) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Field returns the value of a field by its name in GitFields, such as
+// "short-commit". Dirty is "true" or "false".
+func (g *GitInfo) Field(name string) (string, bool) {
+	switch name {
+	case "version":
+		return g.Version, true
+	case "tag":
+		return g.Tag, true
+	case "commit":
+		return g.Commit, true
+	case "short-commit":
+		return g.ShortCommit, true
+	case "dirty":
+		return strconv.FormatBool(g.Dirty), true
+	case "commit-date":
+		return g.CommitDate, true
+	}
+
+	return "", false
+}
+
+// ErrNotGitRepository is returned by ReadGitInfo when the directory isn't
+// inside a git repository.
+var ErrNotGitRepository = errors.New("not a git repository")
+
+// ReadGitInfo returns the version information of the git repository that
+// dir is in. It reads the repository directly rather than running git,
+// other than to tell whether the working tree is dirty when that can't be
+// done from the repository alone, see gitRepo.dirty, in which case it is
+// an error if git isn't installed. Repositories that use SHA-256 object
+// names aren't supported.
+func ReadGitInfo(dir string) (*GitInfo, error) {
+	repo, err := openGitRepo(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer repo.close()
+
+	head, err := repo.resolveRef("HEAD")
+	if err != nil {
+		return nil, err
+	}
+
+	commit, err := repo.readCommit(head)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &GitInfo{
+		Commit:      head,
+		ShortCommit: head[:7],
+		CommitDate:  commit.date.UTC().Format(time.RFC3339),
+	}
+
+	tag, distance, err := repo.describe(head)
+	if err != nil {
+		return nil, err
+	}
+
+	info.Tag = tag
+	switch {
+	case tag == "":
+		info.Version = info.ShortCommit
+	case distance == 0:
+		info.Version = tag
+	default:
+		info.Version = fmt.Sprintf("%s-%d-g%s", tag, distance, info.ShortCommit)
+	}
+
+	info.Dirty, err = repo.dirty(commit.tree)
+	if errors.Is(err, errGitStatus) {
+		info.Dirty, err = repo.statusDirty(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info.Dirty {
+		info.Version += "-dirty"
+	}
+
+	return info, nil
+}
+
+// errGitStatus is returned when whether the working tree is dirty can't be
+// told from the repository alone, so git has to be asked. errGitContent is
+// the case of a file that git converts in a way that isn't supported, such
+// as by a clean filter other than LFS.
+var (
+	errGitStatus  = errors.New("git status is needed")
+	errGitContent = fmt.Errorf("%w: a file is converted by git", errGitStatus)
+)
+
+// gitRepo is a git repository opened for reading.
+type gitRepo struct {
+	// gitDir has HEAD and the index, and commonDir the refs and objects.
+	// They are the same unless the working tree is a linked worktree.
+	gitDir    string
+	commonDir string
+	workTree  string
+
+	// config is the configuration of the repository, over the global and
+	// system ones, see readGitConfig.
+	config map[string]string
+
+	// attributes are the rules of the gitattributes files read so far,
+	// by path.
+	attributes map[string][]gitAttrRule
+
+	packs []*gitPack
+}
+
+// openGitRepo opens the repository that dir is in, looking for .git in dir
+// and then in each of its parents.
+func openGitRepo(dir string) (*gitRepo, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		dotGit := filepath.Join(dir, ".git")
+		info, err := os.Stat(dotGit)
+		if err == nil {
+			repo := &gitRepo{gitDir: dotGit, workTree: dir}
+
+			// In linked worktrees and submodules .git is a file that
+			// points to the real git directory.
+			if !info.IsDir() {
+				data, err := os.ReadFile(dotGit)
+				if err != nil {
+					return nil, err
+				}
+
+				path, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: ")
+				if !ok {
+					return nil, fmt.Errorf("%s: invalid gitdir file", dotGit)
+				}
+				if !filepath.IsAbs(path) {
+					path = filepath.Join(dir, path)
+				}
+				repo.gitDir = path
+			}
+
+			repo.commonDir = repo.gitDir
+			if data, err := os.ReadFile(filepath.Join(repo.gitDir, "commondir")); err == nil {
+				path := strings.TrimSpace(string(data))
+				if !filepath.IsAbs(path) {
+					path = filepath.Join(repo.gitDir, path)
+				}
+				repo.commonDir = path
+			}
+
+			repo.config = make(map[string]string)
+			for _, path := range gitConfigFiles(repo.commonDir) {
+				config, err := readGitConfig(path)
+				if err != nil {
+					return nil, err
+				}
+				for k, v := range config {
+					repo.config[k] = v
+				}
+			}
+			if format := repo.config["extensions.objectformat"]; format != "" && format != "sha1" {
+				return nil, fmt.Errorf("%s: %s git repositories aren't supported", repo.commonDir, format)
+			}
+
+			return repo, repo.openPacks()
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, ErrNotGitRepository
+		}
+		dir = parent
+	}
+}
+
+// gitConfigFiles returns the config files of the repository in commonDir,
+// from the one with the lowest precedence: the system one, unless
+// GIT_CONFIG_NOSYSTEM is set, the global ones, or GIT_CONFIG_GLOBAL, and
+// that of the repository.
+func gitConfigFiles(commonDir string) []string {
+	var files []string
+	if !gitBool(os.Getenv("GIT_CONFIG_NOSYSTEM"), false) {
+		files = append(files, "/etc/gitconfig")
+	}
+
+	if global := os.Getenv("GIT_CONFIG_GLOBAL"); global != "" {
+		files = append(files, global)
+	} else {
+		if xdg := gitXDGPath("config"); xdg != "" {
+			files = append(files, xdg)
+		}
+		if home, err := os.UserHomeDir(); err == nil {
+			files = append(files, filepath.Join(home, ".gitconfig"))
+		}
+	}
+
+	return append(files, filepath.Join(commonDir, "config"))
+}
+
+// readGitConfig returns the values of the git config file at path, keyed
+// by the section, the subsection if any, and the name, such as
+// "core.filemode". Sections and names are lowercase, as they aren't case
+// sensitive. Includes aren't followed.
+func readGitConfig(path string) (map[string]string, error) {
+	config := make(map[string]string)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var section string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if line[0] == '[' {
+			header, _, _ := strings.Cut(line[1:], "]")
+			name, sub, ok := strings.Cut(header, " ")
+			section = strings.ToLower(name)
+			if ok {
+				section += "." + strings.Trim(strings.TrimSpace(sub), `"`)
+			}
+			continue
+		}
+
+		// A name without a value is true.
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			value = "true"
+		}
+		if i := strings.IndexAny(value, "#;"); i >= 0 && !strings.Contains(value[:i], `"`) {
+			value = value[:i]
+		}
+		config[section+"."+strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+
+	return config, nil
+}
+
+// gitBool returns the value of a boolean git config value, or def if it
+// isn't set.
+func gitBool(value string, def bool) bool {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return true
+	case "false", "no", "off", "0":
+		return false
+	}
+
+	return def
+}
+
+func (r *gitRepo) close() {
+	for _, p := range r.packs {
+		p.pack.Close()
+	}
+}
+
+// resolveRef returns the commit that the ref, such as "HEAD" or
+// "refs/heads/main", points to.
+func (r *gitRepo) resolveRef(name string) (string, error) {
+	for i := 0; i < 10; i++ {
+		dir := r.commonDir
+		if name == "HEAD" {
+			dir = r.gitDir
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if errors.Is(err, fs.ErrNotExist) {
+			refs, err := r.packedRefs()
+			if err != nil {
+				return "", err
+			}
+
+			if sha, ok := refs[name]; ok {
+				return sha, nil
+			}
+
+			return "", fmt.Errorf("unknown git ref %s", name)
+		}
+		if err != nil {
+			return "", err
+		}
+
+		value := strings.TrimSpace(string(data))
+		target, ok := strings.CutPrefix(value, "ref: ")
+		if !ok {
+			return value, nil
+		}
+		name = target
+	}
+
+	return "", fmt.Errorf("too many levels of symbolic git refs")
+}
+
+// packedRefs returns the refs in packed-refs. The tags are peeled: they
+// point to the commit even if they are annotated.
+func (r *gitRepo) packedRefs() (map[string]string, error) {
+	refs := make(map[string]string)
+	data, err := os.ReadFile(filepath.Join(r.commonDir, "packed-refs"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return refs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var last string
+	for _, line := range strings.Split(string(data), "\n") {
+		switch {
+		case line == "" || line[0] == '#':
+		case line[0] == '^':
+			if last != "" {
+				refs[last] = line[1:]
+			}
+		default:
+			sha, name, ok := strings.Cut(line, " ")
+			if !ok {
+				continue
+			}
+
+			refs[name] = sha
+			last = name
+		}
+	}
+
+	return refs, nil
+}
+
+// tags returns the name of the tags for each commit. Packed tags are
+// already peeled, so only the loose ones are read to find their commit.
+func (r *gitRepo) tags() (map[string][]string, error) {
+	refs, err := r.packedRefs()
+	if err != nil {
+		return nil, err
+	}
+
+	// Loose refs take precedence over packed ones.
+	loose := make(map[string]bool)
+	tagsDir := filepath.Join(r.commonDir, "refs", "tags")
+	err = filepath.WalkDir(tagsDir, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(r.commonDir, path)
+		if err != nil {
+			return err
+		}
+
+		name := filepath.ToSlash(rel)
+		refs[name] = strings.TrimSpace(string(data))
+		loose[name] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make(map[string][]string)
+	for name, sha := range refs {
+		tag, ok := strings.CutPrefix(name, "refs/tags/")
+		if !ok {
+			continue
+		}
+
+		// Peel annotated tags down to the commit.
+		for i := 0; loose[name] && i < 10; i++ {
+			kind, data, err := r.readObject(sha)
+			if err != nil {
+				return nil, err
+			}
+			if kind != "tag" {
+				break
+			}
+
+			object, _, _ := strings.Cut(string(data), "\n")
+			sha = strings.TrimPrefix(object, "object ")
+		}
+
+		tags[sha] = append(tags[sha], tag)
+	}
+
+	return tags, nil
+}
+
+// gitMaxCandidates is the number of tags that describe considers, as in
+// "git describe".
+const gitMaxCandidates = 10
+
+// gitDescriptions caches the results of describe by the repository, the
+// commit and the tags, since every package of a repository has the same.
+var gitDescriptions sync.Map
+
+// gitDescription is the result of describe.
+type gitDescription struct {
+	tag      string
+	distance int
+}
+
+// describe returns the nearest tag to the commit and the number of commits
+// since it, like "git describe --tags", and in the same way: the history
+// is walked from the commit newest first until gitMaxCandidates tags are
+// found, counting for each tag the commits walked that it can't reach. The
+// tag with the fewest wins, and the walk goes on until the count of the
+// winner is known. The history stops at the boundaries of a shallow clone.
+func (r *gitRepo) describe(head string) (string, int, error) {
+	tags, err := r.tags()
+	if err != nil || len(tags) == 0 {
+		return "", 0, err
+	}
+	if names, ok := tags[head]; ok {
+		return newestTagName(names), 0, nil
+	}
+
+	refs := make([]string, 0, len(tags))
+	for sha, names := range tags {
+		sort.Strings(names)
+		refs = append(refs, sha+" "+strings.Join(names, " "))
+	}
+	sort.Strings(refs)
+	key := r.commonDir + "\n" + head + "\n" + strings.Join(refs, "\n")
+	if d, ok := gitDescriptions.Load(key); ok {
+		d := d.(gitDescription)
+		return d.tag, d.distance, nil
+	}
+
+	shallow, err := r.shallow()
+	if err != nil {
+		return "", 0, err
+	}
+
+	w := &gitWalk{repo: r, shallow: shallow, commits: make(map[string]*gitWalkCommit)}
+	if err := w.push(head, 0); err != nil {
+		return "", 0, err
+	}
+
+	type candidate struct {
+		sha   string
+		depth int
+		flag  uint32
+	}
+	var candidates []*candidate
+	var gaveUpOn *gitWalkCommit
+	seen := 0
+	for w.Len() > 0 {
+		c := heap.Pop(w).(*gitWalkCommit)
+		seen++
+
+		if _, ok := tags[c.sha]; ok {
+			if len(candidates) == gitMaxCandidates {
+				gaveUpOn = c
+				break
+			}
+			t := &candidate{sha: c.sha, depth: seen - 1, flag: 1 << len(candidates)}
+			candidates = append(candidates, t)
+			c.flags |= t.flag
+		}
+
+		for _, t := range candidates {
+			if c.flags&t.flag == 0 {
+				t.depth++
+			}
+		}
+
+		if err := w.pushParents(c); err != nil {
+			return "", 0, err
+		}
+	}
+	if len(candidates) == 0 {
+		return "", 0, nil
+	}
+
+	// Of the tags as near, the first found wins.
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].depth < candidates[j].depth
+	})
+	best := candidates[0]
+
+	// Count the rest of the commits that the best tag can't reach, until
+	// only commits that it can reach are left.
+	if gaveUpOn != nil {
+		heap.Push(w, gaveUpOn)
+	}
+	for w.Len() > 0 {
+		c := heap.Pop(w).(*gitWalkCommit)
+		if c.flags&best.flag != 0 {
+			within := true
+			for _, other := range w.queue {
+				within = within && other.flags&best.flag != 0
+			}
+			if within {
+				break
+			}
+		} else {
+			best.depth++
+		}
+
+		if err := w.pushParents(c); err != nil {
+			return "", 0, err
+		}
+	}
+
+	d := gitDescription{tag: newestTagName(tags[best.sha]), distance: best.depth}
+	gitDescriptions.Store(key, d)
+	return d.tag, d.distance, nil
+}
+
+// gitWalk is a walk of the history, newest commit first. Commits with the
+// same date come out in the order they were pushed, as in git.
+type gitWalk struct {
+	repo    *gitRepo
+	shallow map[string]bool
+	commits map[string]*gitWalkCommit
+	queue   []*gitWalkCommit
+	pushed  int
+}
+
+// gitWalkCommit is a commit of a walk. Its flags are those of the tags
+// that can reach it.
+type gitWalkCommit struct {
+	sha     string
+	date    time.Time
+	parents []string
+	flags   uint32
+	order   int
+}
+
+// push reads the commit and adds it to the walk with the flags, or only
+// adds the flags if it has already been seen.
+func (w *gitWalk) push(sha string, flags uint32) error {
+	if c, ok := w.commits[sha]; ok {
+		c.flags |= flags
+		return nil
+	}
+
+	commit, err := w.repo.readCommit(sha)
+	if err != nil {
+		return err
+	}
+
+	c := &gitWalkCommit{sha: sha, date: commit.date, parents: commit.parents, flags: flags}
+	if w.shallow[sha] {
+		c.parents = nil
+	}
+	w.commits[sha] = c
+	heap.Push(w, c)
+	return nil
+}
+
+// pushParents pushes the parents of the commit with its flags.
+func (w *gitWalk) pushParents(c *gitWalkCommit) error {
+	for _, parent := range c.parents {
+		if err := w.push(parent, c.flags); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *gitWalk) Len() int { return len(w.queue) }
+
+func (w *gitWalk) Less(i, j int) bool {
+	if !w.queue[i].date.Equal(w.queue[j].date) {
+		return w.queue[i].date.After(w.queue[j].date)
+	}
+	return w.queue[i].order < w.queue[j].order
+}
+
+func (w *gitWalk) Swap(i, j int) { w.queue[i], w.queue[j] = w.queue[j], w.queue[i] }
+
+func (w *gitWalk) Push(x any) {
+	c := x.(*gitWalkCommit)
+	c.order = w.pushed
+	w.pushed++
+	w.queue = append(w.queue, c)
+}
+
+func (w *gitWalk) Pop() any {
+	c := w.queue[len(w.queue)-1]
+	w.queue = w.queue[:len(w.queue)-1]
+	return c
+}
+
+// newestTagName returns the name that describe uses of the tags of a
+// commit.
+func newestTagName(names []string) string {
+	sort.Strings(names)
+	return names[len(names)-1]
+}
+
+// shallow returns the commits at the boundaries of a shallow clone, whose
+// parents aren't in the repository.
+func (r *gitRepo) shallow() (map[string]bool, error) {
+	shallow := make(map[string]bool)
+	data, err := os.ReadFile(filepath.Join(r.commonDir, "shallow"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return shallow, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sha := range strings.Fields(string(data)) {
+		shallow[sha] = true
+	}
+
+	return shallow, nil
+}
+
+// gitCommit is the part of a commit object that is needed.
+type gitCommit struct {
+	tree    string
+	parents []string
+	date    time.Time
+}
+
+func (r *gitRepo) readCommit(sha string) (*gitCommit, error) {
+	kind, data, err := r.readObject(sha)
+	if err != nil {
+		return nil, err
+	}
+	if kind != "commit" {
+		return nil, fmt.Errorf("git object %s is a %s, not a commit", sha, kind)
+	}
+
+	commit := &gitCommit{}
+	header, _, _ := strings.Cut(string(data), "\n\n")
+	for _, line := range strings.Split(header, "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "tree":
+			commit.tree = value
+		case "parent":
+			commit.parents = append(commit.parents, value)
+		case "committer":
+			// The committer ends with the Unix time and the timezone.
+			fields := strings.Fields(value)
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("git commit %s: invalid committer", sha)
+			}
+
+			ts, err := strconv.ParseInt(fields[len(fields)-2], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("git commit %s: invalid committer", sha)
+			}
+			commit.date = time.Unix(ts, 0)
+		}
+	}
+
+	return commit, nil
+}
+
+// readObject returns the type and content of the object, which is either
+// loose or in a pack.
+func (r *gitRepo) readObject(sha string) (string, []byte, error) {
+	if len(sha) != 40 {
+		return "", nil, fmt.Errorf("invalid git object %q", sha)
+	}
+
+	path := filepath.Join(r.commonDir, "objects", sha[:2], sha[2:])
+	f, err := os.Open(path)
+	if err == nil {
+		defer f.Close()
+		return readLooseObject(f)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return "", nil, err
+	}
+
+	id, err := hex.DecodeString(sha)
+	if err != nil {
+		return "", nil, err
+	}
+
+	for _, p := range r.packs {
+		if offset, ok := p.find(id); ok {
+			return r.readPacked(p, offset)
+		}
+	}
+
+	return "", nil, fmt.Errorf("git object %s not found", sha)
+}
+
+func readLooseObject(f io.Reader) (string, []byte, error) {
+	zr, err := zlib.NewReader(f)
+	if err != nil {
+		return "", nil, err
+	}
+	defer zr.Close()
+
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return "", nil, err
+	}
+
+	header, content, ok := bytes.Cut(data, []byte{0})
+	if !ok {
+		return "", nil, fmt.Errorf("invalid git object header")
+	}
+
+	kind, _, _ := strings.Cut(string(header), " ")
+	return kind, content, nil
+}
+
+// gitPack is a pack file and its index.
+type gitPack struct {
+	pack    *os.File
+	fanout  [256]uint32
+	ids     []byte
+	offsets []byte
+	large   []byte
+}
+
+// openPacks opens the version 2 indexes of the pack files, and returns an
+// error for the indexes of any other version.
+func (r *gitRepo) openPacks() error {
+	paths, err := filepath.Glob(filepath.Join(r.commonDir, "objects", "pack", "*.idx"))
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		idx, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		// Version 1 indexes have no header, so they start with the
+		// fanout table instead.
+		if len(idx) < 8+256*4 {
+			return fmt.Errorf("%s: truncated pack index", path)
+		}
+		if !bytes.Equal(idx[:4], []byte{0xff, 't', 'O', 'c'}) {
+			return fmt.Errorf("%s: version 1 pack indexes aren't supported", path)
+		}
+		if version := binary.BigEndian.Uint32(idx[4:]); version != 2 {
+			return fmt.Errorf("%s: version %d pack indexes aren't supported", path, version)
+		}
+
+		p := &gitPack{}
+		for i := range p.fanout {
+			p.fanout[i] = binary.BigEndian.Uint32(idx[8+i*4:])
+		}
+
+		n := int(p.fanout[255])
+		pos := 8 + 256*4
+		if len(idx) < pos+n*(20+4+4) {
+			return fmt.Errorf("%s: truncated pack index", path)
+		}
+		p.ids = idx[pos : pos+n*20]
+		pos += n*20 + n*4 // skip the CRCs
+		p.offsets = idx[pos : pos+n*4]
+		p.large = idx[pos+n*4:]
+
+		p.pack, err = os.Open(strings.TrimSuffix(path, ".idx") + ".pack")
+		if err != nil {
+			return err
+		}
+
+		r.packs = append(r.packs, p)
+	}
+
+	return nil
+}
+
+// find returns the offset of the object in the pack.
+func (p *gitPack) find(id []byte) (int64, bool) {
+	lo := 0
+	if id[0] > 0 {
+		lo = int(p.fanout[id[0]-1])
+	}
+	hi := int(p.fanout[id[0]])
+
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		return bytes.Compare(p.ids[(lo+i)*20:(lo+i+1)*20], id) >= 0
+	})
+	if i >= hi || !bytes.Equal(p.ids[i*20:(i+1)*20], id) {
+		return 0, false
+	}
+
+	offset := binary.BigEndian.Uint32(p.offsets[i*4:])
+	if offset&0x80000000 == 0 {
+		return int64(offset), true
+	}
+
+	// The offsets over 2GiB are in the table of large offsets.
+	large := int(offset&0x7fffffff) * 8
+	if large+8 > len(p.large) {
+		return 0, false
+	}
+	return int64(binary.BigEndian.Uint64(p.large[large:])), true
+}
+
+// gitPackTypes are the types of the objects in a pack. The deltas are
+// resolved by readPacked.
+var gitPackTypes = map[byte]string{1: "commit", 2: "tree", 3: "blob", 4: "tag"}
+
+// readPacked returns the type and content of the object at the offset in
+// the pack, resolving deltas against their base objects.
+func (r *gitRepo) readPacked(p *gitPack, offset int64) (string, []byte, error) {
+	br := bufio.NewReader(io.NewSectionReader(p.pack, offset, 1<<62))
+
+	b, err := br.ReadByte()
+	if err != nil {
+		return "", nil, err
+	}
+	kind := (b >> 4) & 7
+	for b&0x80 != 0 {
+		if b, err = br.ReadByte(); err != nil {
+			return "", nil, err
+		}
+	}
+
+	var baseKind string
+	var base []byte
+	switch kind {
+	case 6:
+		// The base is at a relative offset before this object.
+		b, err := br.ReadByte()
+		if err != nil {
+			return "", nil, err
+		}
+		rel := int64(b & 0x7f)
+		for b&0x80 != 0 {
+			if b, err = br.ReadByte(); err != nil {
+				return "", nil, err
+			}
+			rel = ((rel + 1) << 7) | int64(b&0x7f)
+		}
+
+		if baseKind, base, err = r.readPacked(p, offset-rel); err != nil {
+			return "", nil, err
+		}
+	case 7:
+		// The base is given by its ID.
+		id := make([]byte, 20)
+		if _, err := io.ReadFull(br, id); err != nil {
+			return "", nil, err
+		}
+
+		if baseKind, base, err = r.readObject(hex.EncodeToString(id)); err != nil {
+			return "", nil, err
+		}
+	}
+
+	zr, err := zlib.NewReader(br)
+	if err != nil {
+		return "", nil, err
+	}
+	defer zr.Close()
+
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if base == nil {
+		name, ok := gitPackTypes[kind]
+		if !ok {
+			return "", nil, fmt.Errorf("unknown git pack object type %d", kind)
+		}
+
+		return name, data, nil
+	}
+
+	data, err = applyGitDelta(base, data)
+	return baseKind, data, err
+}
+
+// applyGitDelta applies a delta from a pack to its base.
+func applyGitDelta(base []byte, delta []byte) ([]byte, error) {
+	errInvalid := errors.New("invalid git delta")
+
+	varint := func() (int, bool) {
+		n, shift := 0, 0
+		for len(delta) > 0 {
+			b := delta[0]
+			delta = delta[1:]
+			n |= int(b&0x7f) << shift
+			shift += 7
+			if b&0x80 == 0 {
+				return n, true
+			}
+		}
+		return 0, false
+	}
+
+	baseSize, ok := varint()
+	if !ok || baseSize != len(base) {
+		return nil, errInvalid
+	}
+	size, ok := varint()
+	if !ok {
+		return nil, errInvalid
+	}
+
+	out := make([]byte, 0, size)
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+
+		if op&0x80 == 0 {
+			// Insert the next op bytes.
+			n := int(op)
+			if n == 0 || n > len(delta) {
+				return nil, errInvalid
+			}
+			out = append(out, delta[:n]...)
+			delta = delta[n:]
+			continue
+		}
+
+		// Copy from the base, with the offset and size in the bytes
+		// flagged by the op.
+		var offset, n int
+		for i := 0; i < 7; i++ {
+			if op&(1<<i) == 0 {
+				continue
+			}
+			if len(delta) == 0 {
+				return nil, errInvalid
+			}
+			if i < 4 {
+				offset |= int(delta[0]) << (8 * i)
+			} else {
+				n |= int(delta[0]) << (8 * (i - 4))
+			}
+			delta = delta[1:]
+		}
+		if n == 0 {
+			n = 0x10000
+		}
+		if offset+n > len(base) {
+			return nil, errInvalid
+		}
+		out = append(out, base[offset:offset+n]...)
+	}
+
+	if len(out) != size {
+		return nil, errInvalid
+	}
+
+	return out, nil
+}
+
+// gitIndexEntry is an entry of the index.
+type gitIndexEntry struct {
+	path  string
+	mode  uint32
+	id    string
+	size  uint32
+	mtime time.Time
+	stage int
+
+	// skipWorktree is set for the entries outside of a sparse checkout,
+	// which aren't in the working tree.
+	skipWorktree bool
+}
+
+// readIndex returns the entries of the index and its modification time.
+func (r *gitRepo) readIndex() ([]gitIndexEntry, time.Time, error) {
+	path := filepath.Join(r.gitDir, "index")
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, time.Time{}, nil
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	errInvalid := fmt.Errorf("%s: invalid git index", path)
+	if len(data) < 12 || string(data[:4]) != "DIRC" {
+		return nil, time.Time{}, errInvalid
+	}
+
+	version := binary.BigEndian.Uint32(data[4:])
+	if version < 2 || version > 4 {
+		return nil, time.Time{}, fmt.Errorf("%s: unsupported git index version %d", path, version)
+	}
+
+	n := int(binary.BigEndian.Uint32(data[8:]))
+	entries := make([]gitIndexEntry, 0, n)
+	pos := 12
+	var previous string
+	for i := 0; i < n; i++ {
+		start := pos
+		if pos+62 > len(data) {
+			return nil, time.Time{}, errInvalid
+		}
+
+		e := gitIndexEntry{
+			mtime: time.Unix(int64(binary.BigEndian.Uint32(data[pos+8:])), int64(binary.BigEndian.Uint32(data[pos+12:]))),
+			mode:  binary.BigEndian.Uint32(data[pos+24:]),
+			size:  binary.BigEndian.Uint32(data[pos+36:]),
+			id:    hex.EncodeToString(data[pos+40 : pos+60]),
+		}
+		flags := binary.BigEndian.Uint16(data[pos+60:])
+		e.stage = int(flags>>12) & 3
+		pos += 62
+		if flags&0x4000 != 0 {
+			if pos+2 > len(data) {
+				return nil, time.Time{}, errInvalid
+			}
+			e.skipWorktree = binary.BigEndian.Uint16(data[pos:])&0x4000 != 0
+			pos += 2
+		}
+
+		if version == 4 {
+			// The path is compressed against the previous one: strip
+			// some bytes from its end, then append the rest.
+			strip, read := binary.Uvarint(data[pos:])
+			if read <= 0 || int(strip) > len(previous) {
+				return nil, time.Time{}, errInvalid
+			}
+			pos += read
+
+			end := bytes.IndexByte(data[pos:], 0)
+			if end < 0 {
+				return nil, time.Time{}, errInvalid
+			}
+			e.path = previous[:len(previous)-int(strip)] + string(data[pos:pos+end])
+			pos += end + 1
+		} else {
+			end := bytes.IndexByte(data[pos:], 0)
+			if end < 0 {
+				return nil, time.Time{}, errInvalid
+			}
+			e.path = string(data[pos : pos+end])
+
+			// Entries are padded with NULs to a multiple of 8 bytes.
+			pos = start + (pos+end-start+8)&^7
+		}
+
+		previous = e.path
+		entries = append(entries, e)
+	}
+
+	// The extensions follow the entries, and the checksum ends the index.
+	// A split index has only some of the entries, and a sparse index has
+	// directories in place of the entries under them, so neither can be
+	// compared with the tree.
+	for pos+8 <= len(data)-20 {
+		signature := string(data[pos : pos+4])
+		if signature == "link" || signature == "sdir" {
+			return nil, time.Time{}, fmt.Errorf("%w: %s has a %q extension", errGitStatus, path, signature)
+		}
+		pos += 8 + int(binary.BigEndian.Uint32(data[pos+4:]))
+	}
+
+	return entries, info.ModTime(), nil
+}
+
+// readTree returns the blobs in the tree and its subtrees, by path.
+func (r *gitRepo) readTree(sha string, prefix string, blobs map[string]gitIndexEntry) error {
+	kind, data, err := r.readObject(sha)
+	if err != nil {
+		return err
+	}
+	if kind != "tree" {
+		return fmt.Errorf("git object %s is a %s, not a tree", sha, kind)
+	}
+
+	for len(data) > 0 {
+		header, rest, ok := bytes.Cut(data, []byte{0})
+		if !ok || len(rest) < 20 {
+			return fmt.Errorf("invalid git tree %s", sha)
+		}
+
+		modeStr, name, _ := strings.Cut(string(header), " ")
+		mode, err := strconv.ParseUint(modeStr, 8, 32)
+		if err != nil {
+			return fmt.Errorf("invalid git tree %s", sha)
+		}
+
+		id := hex.EncodeToString(rest[:20])
+		data = rest[20:]
+
+		if mode == 0o40000 {
+			if err := r.readTree(id, prefix+name+"/", blobs); err != nil {
+				return err
+			}
+			continue
+		}
+
+		blobs[prefix+name] = gitIndexEntry{path: prefix + name, mode: uint32(mode), id: id}
+	}
+
+	return nil
+}
+
+// dirty returns true if the index differs from the tree of the commit, or
+// if any file in the working tree differs from the index. Files that
+// aren't tracked are ignored, as in "git describe --dirty", and files are
+// compared as git would add them, see cleanContent. It returns errGitStatus
+// when that can't be told without git, see statusDirty.
+func (r *gitRepo) dirty(tree string) (bool, error) {
+	entries, indexTime, err := r.readIndex()
+	if err != nil {
+		return false, err
+	}
+
+	blobs := make(map[string]gitIndexEntry)
+	if err := r.readTree(tree, "", blobs); err != nil {
+		return false, err
+	}
+
+	if len(entries) != len(blobs) {
+		return true, nil
+	}
+
+	for _, e := range entries {
+		blob, ok := blobs[e.path]
+		if !ok || e.stage != 0 || blob.id != e.id || blob.mode != e.mode {
+			return true, nil
+		}
+
+		// Submodules have their own working tree, and the entries
+		// outside of a sparse checkout aren't in it.
+		if e.mode == 0o160000 || e.skipWorktree {
+			continue
+		}
+
+		changed, err := r.changed(&e, indexTime)
+		if err != nil || changed {
+			return changed, err
+		}
+	}
+
+	return false, nil
+}
+
+// changed returns true if the file in the working tree differs from its
+// entry in the index.
+func (r *gitRepo) changed(e *gitIndexEntry, indexTime time.Time) (bool, error) {
+	path := filepath.Join(r.workTree, filepath.FromSlash(e.path))
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var content []byte
+	switch {
+	case e.mode == 0o120000:
+		if info.Mode()&fs.ModeSymlink == 0 {
+			return true, nil
+		}
+
+		target, err := os.Readlink(path)
+		if err != nil {
+			return false, err
+		}
+		content = []byte(filepath.ToSlash(target))
+	case !info.Mode().IsRegular():
+		return true, nil
+	default:
+		// Windows has no executable bit, and it isn't tracked with
+		// core.fileMode off.
+		executable := info.Mode()&0o111 != 0
+		fileMode := gitBool(r.config["core.filemode"], true)
+		if runtime.GOOS != "windows" && fileMode && executable != (e.mode == 0o100755) {
+			return true, nil
+		}
+
+		// Trust the stat data, unless the file was modified at the
+		// same time as or after the index was written, in which case
+		// it may have changed without its size or time changing.
+		if uint32(info.Size()) == e.size && info.ModTime().Equal(e.mtime) && info.ModTime().Before(indexTime) {
+			return false, nil
+		}
+
+		if content, err = os.ReadFile(path); err != nil {
+			return false, err
+		}
+	}
+
+	// Regular files are converted when they are added, for end of lines
+	// or by a clean filter.
+	candidates := [][]byte{content}
+	if e.mode != 0o120000 {
+		if candidates, err = r.cleanContent(e, content); candidates == nil {
+			return false, err
+		}
+	}
+
+	for _, content := range candidates {
+		h := sha1.New()
+		fmt.Fprintf(h, "blob %d\x00", len(content))
+		h.Write(content)
+		if hex.EncodeToString(h.Sum(nil)) == e.id {
+			return false, nil
+		}
+	}
+
+	return true, err
+}
+
+// statusDirty returns true if "git status" reports changes to the files
+// that are tracked, for when dirty returned err because it can't tell
+// without git. It is an error if git isn't installed then.
+func (r *gitRepo) statusDirty(err error) (bool, error) {
+	cmd := exec.Command("git", "--no-optional-locks", "status", "--porcelain", "--untracked-files=no")
+	cmd.Dir = r.workTree
+	out, statusErr := cmd.Output()
+	if errors.Is(statusErr, exec.ErrNotFound) {
+		return false, fmt.Errorf("git is needed to tell whether %s is dirty, since %s", r.workTree, err)
+	}
+	if statusErr != nil {
+		return false, fmt.Errorf("git status, since %s: %w", err, statusErr)
+	}
+
+	return len(bytes.TrimSpace(out)) > 0, nil
+}
@@ -0,0 +1,300 @@
+package gox
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// gitAttrRule is a line of a gitattributes file: a pattern and the
+// attributes of the paths that match it. An attribute is "true" when it is
+// set, "false" when it is unset and its value otherwise.
+type gitAttrRule struct {
+	pattern *regexp.Regexp
+	attrs   map[string]string
+}
+
+// gitAttributes returns the attributes of the path, relative to the
+// working tree and slash separated. The global attributes file comes first,
+// then the .gitattributes files from the root of the working tree down to
+// the directory of the path, then info/attributes, and later lines take
+// precedence over earlier ones.
+func (r *gitRepo) gitAttributes(name string) (map[string]string, error) {
+	files := []string{r.config["core.attributesfile"]}
+	if files[0] == "" {
+		files[0] = gitXDGPath("attributes")
+	}
+
+	dir := ""
+	for _, elem := range strings.Split(path.Dir(name), "/") {
+		if elem != "." {
+			dir = path.Join(dir, elem)
+		}
+		files = append(files, filepath.Join(r.workTree, filepath.FromSlash(dir), ".gitattributes"))
+	}
+	files = append(files, filepath.Join(r.commonDir, "info", "attributes"))
+
+	attrs := make(map[string]string)
+	for i, file := range files {
+		if file == "" {
+			continue
+		}
+
+		// The patterns of a .gitattributes file are relative to its
+		// directory, and those of the others to the working tree.
+		base := ""
+		if i > 0 && i < len(files)-1 {
+			base, _ = filepath.Rel(r.workTree, filepath.Dir(file))
+			base = strings.TrimPrefix(filepath.ToSlash(base), ".")
+		}
+
+		rules, err := r.readGitAttributes(file)
+		if err != nil {
+			return nil, err
+		}
+
+		rel := name
+		if base != "" {
+			rel = strings.TrimPrefix(name, base+"/")
+		}
+		for _, rule := range rules {
+			if !rule.pattern.MatchString(rel) {
+				continue
+			}
+			for k, v := range rule.attrs {
+				if v == "" {
+					delete(attrs, k)
+				} else {
+					attrs[k] = v
+				}
+			}
+		}
+	}
+
+	return attrs, nil
+}
+
+// readGitAttributes returns the rules of the gitattributes file, which are
+// cached by the repository.
+func (r *gitRepo) readGitAttributes(file string) ([]gitAttrRule, error) {
+	if rules, ok := r.attributes[file]; ok {
+		return rules, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	var rules []gitAttrRule
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "[attr]") {
+			continue
+		}
+
+		// An unspecified attribute is an empty string, so that it
+		// resets the attribute when the rule is applied.
+		rule := gitAttrRule{pattern: gitAttrPattern(fields[0]), attrs: make(map[string]string)}
+		for _, attr := range fields[1:] {
+			switch {
+			case attr == "binary":
+				rule.attrs["text"] = "false"
+			case strings.HasPrefix(attr, "-"):
+				rule.attrs[attr[1:]] = "false"
+			case strings.HasPrefix(attr, "!"):
+				rule.attrs[attr[1:]] = ""
+			default:
+				k, v, ok := strings.Cut(attr, "=")
+				if !ok {
+					v = "true"
+				}
+				rule.attrs[k] = v
+			}
+		}
+		rules = append(rules, rule)
+	}
+
+	if r.attributes == nil {
+		r.attributes = make(map[string][]gitAttrRule)
+	}
+	r.attributes[file] = rules
+	return rules, nil
+}
+
+// gitAttrPattern returns the regular expression of a gitattributes
+// pattern. A pattern without a slash matches the name of a file in any
+// directory, and one with a slash matches the path from the directory of
+// the gitattributes file, where "**" matches any number of directories.
+func gitAttrPattern(pattern string) *regexp.Regexp {
+	var expr strings.Builder
+	if !strings.Contains(pattern, "/") {
+		expr.WriteString("(^|/)")
+	} else {
+		expr.WriteString("^")
+		pattern = strings.TrimPrefix(pattern, "/")
+	}
+
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			expr.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				expr.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		// A pattern that isn't valid matches nothing.
+		return regexp.MustCompile(`^\b$`)
+	}
+	return re
+}
+
+// gitXDGPath returns the path of the named file in the git directory of
+// the XDG configuration, or "" if there is no home directory.
+func gitXDGPath(name string) string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "git", name)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".config", "git", name)
+	}
+	return ""
+}
+
+// cleanContent returns the content of the file as git would add it to the
+// index: with its end of lines converted as its attributes and
+// core.autocrlf say, and as a Git LFS pointer if it is stored with LFS. It
+// returns the candidates when more than one is possible. When only git can
+// convert the file, because of an attribute other than text, eol and
+// filter=lfs, the content is returned as is along with errGitContent, as
+// it is still unchanged if it is the same as the blob.
+func (r *gitRepo) cleanContent(e *gitIndexEntry, content []byte) ([][]byte, error) {
+	attrs, err := r.gitAttributes(e.path)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := [][]byte{content}
+	for _, attr := range []string{"ident", "working-tree-encoding"} {
+		if v := attrs[attr]; v != "" && v != "false" {
+			return candidates, fmt.Errorf("%w: %s has the %s attribute", errGitContent, e.path, attr)
+		}
+	}
+	if filter := attrs["filter"]; filter == "lfs" {
+		// The file is only stored with LFS if it is installed, and it
+		// may already be a pointer if the object wasn't fetched.
+		if !bytes.HasPrefix(content, []byte("version https://git-lfs.github.com/spec/")) {
+			candidates = append(candidates, []byte(fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%x\nsize %d\n", sha256.Sum256(content), len(content))))
+		}
+	} else if filter != "" && filter != "false" {
+		return candidates, fmt.Errorf("%w: %s has the filter %s", errGitContent, e.path, filter)
+	}
+
+	// As in convert.c of git: text always converts, text=auto only the
+	// files that look like text, and without either an eol attribute
+	// implies text, then core.autocrlf decides.
+	text := attrs["text"]
+	if eol := attrs["eol"]; eol == "lf" || eol == "crlf" {
+		if text == "" {
+			text = "true"
+		}
+	}
+	if text == "" {
+		switch strings.ToLower(r.config["core.autocrlf"]) {
+		case "input":
+			text = "auto"
+		default:
+			if gitBool(r.config["core.autocrlf"], false) {
+				text = "auto"
+			}
+		}
+	}
+
+	convert := text == "true"
+	if text == "auto" && bytes.Contains(content, []byte("\r\n")) && !gitIsBinary(content) {
+		// Files committed with CRLF are left alone.
+		_, blob, err := r.readObject(e.id)
+		if err != nil {
+			return nil, err
+		}
+		convert = !bytes.Contains(blob, []byte("\r"))
+	}
+	if convert {
+		for i, c := range candidates {
+			candidates[i] = bytes.ReplaceAll(c, []byte("\r\n"), []byte("\n"))
+		}
+	}
+
+	return candidates, nil
+}
+
+// gitIsBinary returns true if git takes the content to be binary, when it
+// has a NUL, a CR that isn't before a LF or too many characters that
+// aren't printable.
+func gitIsBinary(content []byte) bool {
+	var printable, nonPrintable int
+	for i := 0; i < len(content); i++ {
+		switch c := content[i]; {
+		case c == 0:
+			return true
+		case c == '\r':
+			if i+1 >= len(content) || content[i+1] != '\n' {
+				return true
+			}
+			i++
+		case c == '\n':
+		case c == 127:
+			nonPrintable++
+		case c < 32:
+			switch c {
+			case '\b', '\t', '\033', '\014':
+				printable++
+			default:
+				nonPrintable++
+			}
+		default:
+			printable++
+		}
+	}
+
+	// A file may end with an EOF character.
+	if len(content) > 0 && content[len(content)-1] == '\032' {
+		nonPrintable--
+	}
+
+	return printable>>7 < nonPrintable
+}
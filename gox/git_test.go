@@ -0,0 +1,287 @@
+package gox
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// gitRun runs git in dir, returning its trimmed output.
+func gitRun(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_CONFIG_GLOBAL=/dev/null",
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_AUTHOR_NAME=gox", "GIT_AUTHOR_EMAIL=gox@example.com",
+		"GIT_COMMITTER_NAME=gox", "GIT_COMMITTER_EMAIL=gox@example.com",
+		"GIT_COMMITTER_DATE=2024-03-01T12:00:00Z")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %s\n%s", strings.Join(args, " "), err, out)
+	}
+
+	return strings.TrimSpace(string(out))
+}
+
+func TestReadGitInfo(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	dir := t.TempDir()
+	if _, err := ReadGitInfo(dir); !errors.Is(err, ErrNotGitRepository) {
+		t.Fatalf("bad: %v", err)
+	}
+
+	gitRun(t, dir, "init", "-q")
+
+	// Enough content that packing it makes deltas.
+	content := strings.Repeat("package main\n\nfunc main() {}\n", 100)
+	write := func(name, data string) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	commit := func(name, data string) {
+		write(name, data)
+		gitRun(t, dir, "add", "-A")
+		gitRun(t, dir, "commit", "-q", "-m", name)
+	}
+
+	commit("main.go", content)
+	head := gitRun(t, dir, "rev-parse", "HEAD")
+
+	cases := []struct {
+		Setup    func()
+		Expected GitInfo
+	}{
+		{
+			func() {},
+			GitInfo{Version: "SHORT"},
+		},
+		{
+			func() { gitRun(t, dir, "tag", "-a", "-m", "v1", "v1.0.0") },
+			GitInfo{Version: "v1.0.0", Tag: "v1.0.0"},
+		},
+		{
+			func() {
+				commit("main.go", content+"// one\n")
+				commit("cmd/app/main.go", content)
+				head = gitRun(t, dir, "rev-parse", "HEAD")
+			},
+			GitInfo{Version: "v1.0.0-2-gSHORT", Tag: "v1.0.0"},
+		},
+		{
+			func() { gitRun(t, dir, "gc", "-q", "--aggressive") },
+			GitInfo{Version: "v1.0.0-2-gSHORT", Tag: "v1.0.0"},
+		},
+		{
+			func() { write("untracked.txt", "") },
+			GitInfo{Version: "v1.0.0-2-gSHORT", Tag: "v1.0.0"},
+		},
+		{
+			func() { write("cmd/app/main.go", content+"// two\n") },
+			GitInfo{Version: "v1.0.0-2-gSHORT-dirty", Tag: "v1.0.0", Dirty: true},
+		},
+		{
+			func() { gitRun(t, dir, "add", "-A") },
+			GitInfo{Version: "v1.0.0-2-gSHORT-dirty", Tag: "v1.0.0", Dirty: true},
+		},
+		{
+			func() {
+				gitRun(t, dir, "update-index", "--index-version", "4")
+				gitRun(t, dir, "commit", "-q", "-m", "two")
+				gitRun(t, dir, "tag", "v1.1.0")
+				head = gitRun(t, dir, "rev-parse", "HEAD")
+			},
+			GitInfo{Version: "v1.1.0", Tag: "v1.1.0"},
+		},
+		{
+			func() { os.Remove(filepath.Join(dir, "main.go")) },
+			GitInfo{Version: "v1.1.0-dirty", Tag: "v1.1.0", Dirty: true},
+		},
+	}
+
+	for i, tc := range cases {
+		tc.Setup()
+
+		// ReadGitInfo looks for the repository in the parents of dir.
+		info, err := ReadGitInfo(filepath.Join(dir, "cmd"))
+		if err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+
+		// The expected short commit is only known after the setup.
+		tc.Expected.Version = strings.Replace(tc.Expected.Version, "SHORT", head[:7], 1)
+		tc.Expected.Commit = head
+		tc.Expected.ShortCommit = head[:7]
+		tc.Expected.CommitDate = "2024-03-01T12:00:00Z"
+		if *info != tc.Expected {
+			t.Fatalf("%d: bad: %#v", i, info)
+		}
+	}
+}
+
+func TestApplyGitDelta(t *testing.T) {
+	base := []byte("hello, world")
+
+	// Copy "hello" from the base, insert " there" then copy ", world".
+	delta := []byte{12, 18, 0x90, 5, 6, ' ', 't', 'h', 'e', 'r', 'e', 0x91, 5, 7}
+	out, err := applyGitDelta(base, delta)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(out) != "hello there, world" {
+		t.Fatalf("bad: %q", out)
+	}
+
+	if _, err := applyGitDelta(base, []byte{11, 5}); err == nil {
+		t.Fatal("expected error for wrong base size")
+	}
+}
+
+func TestReadGitInfo_describe(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	dir := t.TempDir()
+	commit := func(name string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name+"\r\n"), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		gitRun(t, dir, "add", "-A")
+		gitRun(t, dir, "commit", "-q", "-m", name)
+	}
+
+	// The files are checked out with CRLF, but added with LF, so their
+	// content differs from their blobs without them being changed.
+	gitRun(t, dir, "init", "-q", "-b", "main")
+	gitRun(t, dir, "config", "core.autocrlf", "true")
+	commit("one")
+	gitRun(t, dir, "tag", "v1.0.0")
+	gitRun(t, dir, "checkout", "-q", "-b", "feature")
+	commit("two")
+	commit("three")
+	commit("four")
+	gitRun(t, dir, "checkout", "-q", "main")
+	commit("five")
+	gitRun(t, dir, "merge", "-q", "--no-ff", "-m", "merge", "feature")
+	commit("six")
+
+	// More tags than describe considers, on a branch merged back.
+	gitRun(t, dir, "checkout", "-q", "-b", "release")
+	for i := 0; i < 12; i++ {
+		commit(fmt.Sprintf("release%d", i))
+		gitRun(t, dir, "tag", fmt.Sprintf("v1.1.%d", i))
+	}
+	gitRun(t, dir, "checkout", "-q", "main")
+	commit("seven")
+	commit("eight")
+	gitRun(t, dir, "merge", "-q", "--no-ff", "-m", "merge", "release")
+	commit("nine")
+
+	shallow := filepath.Join(t.TempDir(), "shallow")
+	gitRun(t, dir, "clone", "-q", "--depth", "2", "--no-single-branch", "file://"+dir, shallow)
+
+	for _, d := range []string{dir, shallow} {
+		info, err := ReadGitInfo(d)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		expected := gitRun(t, d, "describe", "--tags", "--always", "--dirty", "--abbrev=7")
+		if info.Version != expected {
+			t.Fatalf("bad: %#v, expected %s", info, expected)
+		}
+	}
+}
+
+func TestReadGitInfo_attributes(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	if _, err := exec.LookPath("sha256sum"); err != nil {
+		t.Skip("sha256sum not found")
+	}
+
+	dir := t.TempDir()
+	write := func(name, data string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	// The clean filter stands in for Git LFS, which may not be installed.
+	gitRun(t, dir, "init", "-q")
+	gitRun(t, dir, "config", "filter.lfs.clean", `f=$(mktemp); cat > $f; printf 'version https://git-lfs.github.com/spec/v1\noid sha256:%s\nsize %s\n' $(sha256sum < $f | cut -d' ' -f1) $(wc -c < $f); rm $f`)
+	write(".gitattributes", "*.txt text\n*.bin binary\n*.dat filter=lfs\n*.id ident\n")
+	write("crlf.txt", "one\ntwo\n")
+	write("data.bin", "one\r\ntwo\r\n")
+	write("large.dat", "large\n")
+	write("version.id", "$Id$\n")
+	gitRun(t, dir, "add", "-A")
+	gitRun(t, dir, "commit", "-q", "-m", "one")
+	gitRun(t, dir, "tag", "v1.0.0")
+
+	// Without git, the files have to be converted as git would.
+	t.Setenv("PATH", t.TempDir())
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+	cases := []struct {
+		Name    string
+		Content string
+		Dirty   bool
+		Err     string
+	}{
+		{"crlf.txt", "one\r\ntwo\r\n", false, ""},
+		{"crlf.txt", "one\r\ntwo\r\nthree\r\n", true, ""},
+		{"data.bin", "one\ntwo\n", true, ""},
+		{"large.dat", "large\n", false, ""},
+		{"large.dat", "larger\n", true, ""},
+		{"version.id", "$Id: 1234 $\n", false, "git is needed to tell whether"},
+	}
+
+	for i, tc := range cases {
+		original, err := os.ReadFile(filepath.Join(dir, tc.Name))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		write(tc.Name, tc.Content)
+
+		// The stat data can't be trusted when the index is as new as
+		// the file.
+		later := time.Now().Add(time.Hour)
+		if err := os.Chtimes(filepath.Join(dir, tc.Name), later, later); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		info, err := ReadGitInfo(dir)
+		write(tc.Name, string(original))
+		if tc.Err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.Err) {
+				t.Fatalf("%d: bad: %v", i, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+		if info.Dirty != tc.Dirty {
+			t.Fatalf("%d: bad: %#v", i, info)
+		}
+	}
+}
@@ -0,0 +1,578 @@
+package gox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// DefaultOutputTpl is the default output template. The variant is only
+// appended when there is one, so that variants of an arch don't collide.
+const DefaultOutputTpl = "{{.Dir}}_{{.OS}}_{{.Arch}}{{if .Variant}}_{{.Variant}}{{end}}"
+
+type OutputTemplateData struct {
+	Dir        string
+	ImportPath string
+	OS         string
+	Arch       string
+	Variant    string
+
+	// Env is the environment of the build: that of gox with the extra
+	// variables of the build on top. Missing variables are empty.
+	Env map[string]string
+
+	// GitInfo gives the version information of the repository, such as
+	// .Version and .Commit. The fields are empty if it isn't known.
+	GitInfo
+}
+
+type CompileOpts struct {
+	PackagePath string
+	Platform    Platform
+	OutputTpl   string
+	Ldflags     string
+	Gcflags     string
+	Cc          string
+	Cxx         string
+	Asmflags    string
+	Tags        string
+	ModMode     string
+	Buildmode   string
+	BuildVCS    string
+	CgoCflags   string
+	CgoLdflags  string
+	Cgo         bool
+	DisableCgo  bool
+	Rebuild     bool
+	TrimPath    bool
+	GoCmd       string
+	Race        bool
+
+	// CgoToolchain is "zig" to cross-compile cgo with "zig cc", or empty
+	// for the C toolchain from the environment. CgoLibc is the libc that
+	// Zig links against on Linux, see ZigTarget.
+	CgoToolchain string
+	CgoLibc      string
+
+	// Env are extra environment variables, as KEY=value, for the build.
+	Env []string
+
+	// MaxSize is the size budget of the binary in bytes, or zero for no
+	// budget. A Builder fails the build of a binary that is larger.
+	MaxSize int64
+
+	// Overlay is the path of a JSON file that replaces or hides files of
+	// the build, passed to go build as -overlay.
+	Overlay string
+
+	// Verbose passes -v and -x to go build. Log, if not nil, receives the
+	// output of go build as it runs.
+	Verbose bool
+	Log     io.Writer
+
+	// Git is the version information for the templates of the output and
+	// of the flags, or nil if there is none. Stamp maps symbols, such as
+	// "main.version", to the field of Git that is set into them with -X,
+	// see GitInfo.Field.
+	Git   *GitInfo
+	Stamp map[string]string
+}
+
+// NewOutputTemplateData returns the data for the output template of the
+// build with opts.
+func NewOutputTemplateData(opts *CompileOpts) OutputTemplateData {
+	data := OutputTemplateData{
+		Dir:        filepath.Base(opts.PackagePath),
+		ImportPath: opts.PackagePath,
+		OS:         opts.Platform.OS,
+		Arch:       opts.Platform.Arch,
+		Variant:    opts.Platform.Variant,
+		Env:        make(map[string]string),
+	}
+	for _, kv := range append(os.Environ(), opts.Env...) {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			data.Env[k] = v
+		}
+	}
+	if opts.Git != nil {
+		data.GitInfo = *opts.Git
+	}
+
+	return data
+}
+
+// BuildCommand is the go build invocation for a single package and
+// platform.
+type BuildCommand struct {
+	// GoCmd and Args are the command and its arguments, starting with
+	// "build".
+	GoCmd string
+	Args  []string
+
+	// Env is set on top of the environment of gox.
+	Env []string
+
+	// Dir is the working directory, or empty for the current directory.
+	Dir string
+
+	// Output is the absolute path to the output.
+	Output string
+
+	// Cgo is whether cgo is enabled for the build.
+	Cgo bool
+
+	// Ldflags, Gcflags, Asmflags and Tags are the flags once their
+	// templates are executed, with the -X flags of the symbols to stamp
+	// after the linker flags.
+	Ldflags  string
+	Gcflags  string
+	Asmflags string
+	Tags     string
+}
+
+// GoBuildCommand returns the go build invocation for the options given,
+// without running it.
+func GoBuildCommand(opts *CompileOpts) (*BuildCommand, error) {
+	env := []string{
+		"GOOS=" + opts.Platform.OS,
+		"GOARCH=" + opts.Platform.Arch,
+	}
+
+	// Set the variant last so that it takes precedence over any value
+	// inherited from the environment.
+	if opts.Platform.Variant != "" {
+		env = append(env, opts.Platform.VariantEnv()+"="+opts.Platform.Variant)
+	}
+
+	cgo := cgoEnabled(opts)
+
+	// With Zig as the toolchain, use it for any compiler that wasn't set
+	// explicitly.
+	cc, cxx := opts.Cc, opts.Cxx
+	if cgo && opts.CgoToolchain == "zig" {
+		target, err := ZigTarget(opts.Platform, opts.CgoLibc)
+		if err != nil {
+			return nil, err
+		}
+
+		if cc == "" {
+			cc = "zig cc -target " + target
+		}
+		if cxx == "" {
+			cxx = "zig c++ -target " + target
+		}
+	}
+
+	if cc != "" {
+		env = append(env, "CC="+cc)
+	}
+	if cxx != "" {
+		env = append(env, "CXX="+cxx)
+	}
+
+	if opts.CgoCflags != "" {
+		env = append(env, "CGO_CFLAGS="+opts.CgoCflags)
+	}
+	if opts.CgoLdflags != "" {
+		env = append(env, "CGO_LDFLAGS="+opts.CgoLdflags)
+	}
+
+	// If cgo is enabled then set that env var
+	if cgo {
+		env = append(env, "CGO_ENABLED=1")
+	} else {
+		env = append(env, "CGO_ENABLED=0")
+	}
+
+	// The extra environment variables come last so they take precedence.
+	env = append(env, opts.Env...)
+
+	// The output and the flags are templates, so that a single value can
+	// differ by platform.
+	tplData := NewOutputTemplateData(opts)
+	outputPathReal, err := outputPath(opts, &tplData)
+	if err != nil {
+		return nil, err
+	}
+	gcflags, err := executeTemplate("gcflags", opts.Gcflags, &tplData)
+	if err != nil {
+		return nil, err
+	}
+	ldflags, err := executeTemplate("ldflags", opts.Ldflags, &tplData)
+	if err != nil {
+		return nil, err
+	}
+	asmflags, err := executeTemplate("asmflags", opts.Asmflags, &tplData)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := executeTemplate("tags", opts.Tags, &tplData)
+	if err != nil {
+		return nil, err
+	}
+
+	if ldflags, err = stampLdflags(ldflags, opts); err != nil {
+		return nil, err
+	}
+
+	// Go prefixes the import directory with '_' when it is outside
+	// the GOPATH.For this, we just drop it since we move to that
+	// directory to build.
+	chdir := ""
+	packagePath := opts.PackagePath
+	if strings.HasPrefix(packagePath, "_") {
+		if runtime.GOOS == "windows" {
+			// We have to replace weird paths like this:
+			//
+			//   _/c_/Users
+			//
+			// With:
+			//
+			//   c:\Users
+			//
+			re := regexp.MustCompile("^/([a-zA-Z])_/")
+			chdir = re.ReplaceAllString(packagePath[1:], "$1:\\")
+			chdir = strings.Replace(chdir, "/", "\\", -1)
+		} else {
+			chdir = packagePath[1:]
+		}
+
+		packagePath = ""
+	}
+
+	args := []string{"build"}
+
+	if opts.Rebuild {
+		args = append(args, "-a")
+	}
+
+	if opts.TrimPath {
+		args = append(args, "-trimpath")
+	}
+
+	if opts.ModMode != "" {
+		args = append(args, "-mod", opts.ModMode)
+	}
+
+	if opts.Buildmode != "" {
+		args = append(args, "-buildmode", opts.Buildmode)
+	}
+
+	if opts.BuildVCS != "" {
+		args = append(args, "-buildvcs", opts.BuildVCS)
+	}
+
+	if opts.Race {
+		args = append(args, "-race")
+	}
+
+	if opts.Overlay != "" {
+		args = append(args, "-overlay", opts.Overlay)
+	}
+
+	if opts.Verbose {
+		args = append(args, "-v", "-x")
+	}
+
+	if gcflags != "" {
+		args = append(args, "-gcflags", gcflags)
+	}
+
+	if ldflags != "" {
+		args = append(args, "-ldflags", ldflags)
+	}
+
+	if asmflags != "" {
+		args = append(args, "-asmflags", asmflags)
+	}
+
+	if tags != "" {
+		args = append(args, "-tags", tags)
+	}
+
+	args = append(args, "-o", outputPathReal, packagePath)
+
+	return &BuildCommand{
+		GoCmd:  opts.GoCmd,
+		Args:   args,
+		Env:    env,
+		Dir:    chdir,
+		Output: outputPathReal,
+		Cgo:    cgo,
+
+		Ldflags:  ldflags,
+		Gcflags:  gcflags,
+		Asmflags: asmflags,
+		Tags:     tags,
+	}, nil
+}
+
+// GoCrossCompile builds the package for the platform given in opts and
+// returns the absolute path to the output. If ctx is done before the build
+// finishes then go build is killed and any partial output is removed.
+func GoCrossCompile(ctx context.Context, opts *CompileOpts) (string, error) {
+	cmd, err := GoBuildCommand(opts)
+	if err != nil {
+		return "", err
+	}
+	opts.Cgo = cmd.Cgo
+
+	env := append(os.Environ(), cmd.Env...)
+	if _, err := execGo(ctx, cmd.GoCmd, env, cmd.Dir, opts.Log, cmd.Args...); err != nil {
+		if ctx.Err() != nil {
+			os.Remove(cmd.Output)
+			return "", ctx.Err()
+		}
+
+		return "", err
+	}
+
+	return cmd.Output, nil
+}
+
+// PackageDir returns the directory of the package, which may be an import
+// path or a relative path.
+func PackageDir(ctx context.Context, pkg string, GoCmd string) (string, error) {
+	output, err := execGo(ctx, GoCmd, nil, "", nil, "list", "-f", "{{.Dir}}", pkg)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(output), nil
+}
+
+// GoMainDirs returns the file paths to the packages that are "main"
+// packages, from the list of packages given. The list of packages can
+// include relative paths, the special "..." Go keyword, etc.
+func GoMainDirs(ctx context.Context, packages []string, GoCmd string) ([]string, error) {
+	args := make([]string, 0, len(packages)+3)
+	args = append(args, "list", "-f", "{{.Name}}|{{.ImportPath}}")
+	args = append(args, packages...)
+
+	output, err := execGo(ctx, GoCmd, nil, "", nil, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]string, 0, len(output))
+	for _, line := range strings.Split(output, "\n") {
+		if line == "" {
+			continue
+		}
+
+		parts := strings.SplitN(line, "|", 2)
+		if len(parts) != 2 {
+			log.Printf("Bad line reading packages: %s", line)
+			continue
+		}
+
+		if parts[0] == "main" {
+			results = append(results, parts[1])
+		}
+	}
+
+	return results, nil
+}
+
+// GoRoot returns the GOROOT value for the compiled `go` binary.
+func GoRoot() (string, error) {
+	output, err := execGo(context.Background(), "go", nil, "", nil, "env", "GOROOT")
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(output), nil
+}
+
+// GoVersion reads the version of `go` that is on the PATH. This is done
+// instead of `runtime.Version()` because it is possible to run gox against
+// another Go version.
+func GoVersion() (string, error) {
+	// NOTE: We use `go run` instead of `go version` because the output
+	// of `go version` might change whereas the source is guaranteed to run
+	// for some time thanks to Go's compatibility guarantee.
+
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(td)
+
+	// Write the source code for the program that will generate the version
+	sourcePath := filepath.Join(td, "version.go")
+	if err := ioutil.WriteFile(sourcePath, []byte(versionSource), 0644); err != nil {
+		return "", err
+	}
+
+	// Execute and read the version, which will be the only thing on stdout.
+	return execGo(context.Background(), "go", nil, "", nil, "run", sourcePath)
+}
+
+// GoVersionParts parses the version numbers from the version itself
+// into major and minor: 1.5, 1.4, etc.
+func GoVersionParts() (result [2]int, err error) {
+	version, err := GoVersion()
+	if err != nil {
+		return
+	}
+
+	_, err = fmt.Sscanf(version, "go%d.%d", &result[0], &result[1])
+	return
+}
+
+func execGo(ctx context.Context, GoCmd string, env []string, dir string, log io.Writer, args ...string) (string, error) {
+	var stderr, stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, GoCmd, args...)
+	killProcessGroup(cmd)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if log != nil {
+		cmd.Stdout = io.MultiWriter(&stdout, log)
+		cmd.Stderr = io.MultiWriter(&stderr, log)
+	}
+	if env != nil {
+		cmd.Env = env
+	}
+	if dir != "" {
+		cmd.Dir = dir
+	}
+	if err := cmd.Run(); err != nil {
+		return "", &execError{Err: err, Stderr: stderr.String()}
+	}
+
+	return stdout.String(), nil
+}
+
+// execError is the error returned by execGo when the command fails.
+type execError struct {
+	Err    error
+	Stderr string
+}
+
+func (e *execError) Error() string {
+	return fmt.Sprintf("%s\nStderr: %s", e.Err, e.Stderr)
+}
+
+func (e *execError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode returns the exit status of the command, or -1 if it didn't
+// run to completion.
+func (e *execError) ExitCode() int {
+	var exitErr *exec.ExitError
+	if errors.As(e.Err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+
+	return -1
+}
+
+const versionSource = `package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func main() {
+	fmt.Print(runtime.Version())
+}`
+
+// OutputPath returns the absolute path to the output of the build with
+// opts.
+func OutputPath(opts *CompileOpts) (string, error) {
+	data := NewOutputTemplateData(opts)
+	return outputPath(opts, &data)
+}
+
+func outputPath(opts *CompileOpts, data *OutputTemplateData) (string, error) {
+	output, err := executeTemplate("output", opts.OutputTpl, data)
+	if err != nil {
+		return "", err
+	}
+
+	if opts.Platform.OS == "windows" {
+		output += ".exe"
+	}
+
+	// Determine the full path to the output so that we can change our
+	// working directory when executing go build.
+	return filepath.Abs(output)
+}
+
+// cgoEnabled returns true if cgo is enabled for the build of opts. If
+// we're building for our own platform, then enable cgo always. We respect
+// the CGO_ENABLED flag if that is explicitly set on the platform, and the
+// environment of the build has the last word.
+func cgoEnabled(opts *CompileOpts) bool {
+	cgo := opts.Cgo
+	if !cgo && !opts.DisableCgo && os.Getenv("CGO_ENABLED") != "0" {
+		cgo = runtime.GOOS == opts.Platform.OS &&
+			runtime.GOARCH == opts.Platform.Arch
+	}
+
+	for _, kv := range opts.Env {
+		if v, ok := strings.CutPrefix(kv, "CGO_ENABLED="); ok {
+			cgo = v == "1"
+		}
+	}
+
+	return cgo
+}
+
+// executeTemplate executes the template text, the value of the option
+// name, with data.
+func executeTemplate(name string, text string, data any) (string, error) {
+	tpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s template: %w", name, err)
+	}
+
+	var out bytes.Buffer
+	if err := tpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+
+	return out.String(), nil
+}
+
+// stampLdflags returns the linker flags followed by a -X flag for every
+// symbol of opts to stamp.
+func stampLdflags(ldflags string, opts *CompileOpts) (string, error) {
+	if len(opts.Stamp) > 0 && opts.Git == nil {
+		return "", fmt.Errorf("no git information to stamp into %d symbols", len(opts.Stamp))
+	}
+
+	symbols := make([]string, 0, len(opts.Stamp))
+	for symbol := range opts.Stamp {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+
+	for _, symbol := range symbols {
+		value, ok := opts.Git.Field(opts.Stamp[symbol])
+		if !ok {
+			return "", fmt.Errorf("unknown git field %q for %s", opts.Stamp[symbol], symbol)
+		}
+
+		if ldflags != "" {
+			ldflags += " "
+		}
+		ldflags += fmt.Sprintf("-X %s=%s", symbol, value)
+	}
+
+	return ldflags, nil
+}
@@ -0,0 +1,190 @@
+package gox
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGoVersion(t *testing.T) {
+	v, err := GoVersion()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	acceptable := []string{
+		"devel",
+		"go1.0",
+		"go1.1",
+		"go1.2",
+		"go1.3",
+		"go1.4",
+		"go1.5",
+		"go1.6",
+		"go1.7",
+		"go1.8",
+		"go1.9",
+		"go1.10",
+		"go1.11",
+		"go1.12",
+		"go1.13",
+		"go1.14",
+		"go1.15",
+		"go1.16",
+		"go1.17",
+		"go1.18",
+		"go1.19",
+		"go1.20",
+	}
+	found := false
+	for _, expected := range acceptable {
+		if strings.HasPrefix(v, expected) {
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		t.Fatalf("bad: %#v", v)
+	}
+}
+
+func TestGoCrossCompile_canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	output := filepath.Join(t.TempDir(), "gox")
+	_, err := GoCrossCompile(ctx, &CompileOpts{
+		PackagePath: "github.com/authelia/gox",
+		Platform:    Platform{OS: "linux", Arch: "amd64"},
+		OutputTpl:   output,
+		GoCmd:       "go",
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("bad: %v", err)
+	}
+
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Fatalf("expected no output, got: %v", err)
+	}
+}
+
+func TestGoBuildCommand(t *testing.T) {
+	opts := &CompileOpts{
+		PackagePath: "example.com/foo",
+		Platform:    Platform{OS: "windows", Arch: "arm", Variant: "7"},
+		OutputTpl:   "build/{{.Dir}}_{{.OS}}_{{.Arch}}_{{.Variant}}",
+		Ldflags:     "-s -w",
+		Tags:        "netgo",
+		Cc:          "clang",
+		TrimPath:    true,
+		GoCmd:       "go",
+	}
+
+	cmd, err := GoBuildCommand(opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	output, err := filepath.Abs("build/foo_windows_arm_7.exe")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := &BuildCommand{
+		GoCmd:  "go",
+		Args:   []string{"build", "-trimpath", "-ldflags", "-s -w", "-tags", "netgo", "-o", output, "example.com/foo"},
+		Env:    []string{"GOOS=windows", "GOARCH=arm", "GOARM=7", "CC=clang", "CGO_ENABLED=0"},
+		Output: output,
+
+		Ldflags: "-s -w",
+		Tags:    "netgo",
+	}
+	if !reflect.DeepEqual(cmd, expected) {
+		t.Fatalf("bad: %#v", cmd)
+	}
+}
+
+func TestGoBuildCommand_git(t *testing.T) {
+	opts := &CompileOpts{
+		PackagePath: "example.com/foo",
+		Platform:    Platform{OS: "linux", Arch: "amd64"},
+		OutputTpl:   "build/{{.Dir}}_{{.Version}}",
+		Ldflags:     "-s -X main.date={{.CommitDate}}",
+		GoCmd:       "go",
+		Git: &GitInfo{
+			Version:     "v1.2.0-3-gabcdef0-dirty",
+			Tag:         "v1.2.0",
+			Commit:      "abcdef0123456789abcdef0123456789abcdef01",
+			ShortCommit: "abcdef0",
+			Dirty:       true,
+			CommitDate:  "2024-03-01T12:00:00Z",
+		},
+		Stamp: map[string]string{"main.version": "version", "main.dirty": "dirty"},
+	}
+
+	cmd, err := GoBuildCommand(opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if filepath.Base(cmd.Output) != "foo_v1.2.0-3-gabcdef0-dirty" {
+		t.Fatalf("bad: %s", cmd.Output)
+	}
+
+	expected := "-s -X main.date=2024-03-01T12:00:00Z -X main.dirty=true -X main.version=v1.2.0-3-gabcdef0-dirty"
+	if cmd.Args[1] != "-ldflags" || cmd.Args[2] != expected {
+		t.Fatalf("bad: %#v", cmd.Args)
+	}
+
+	opts.Stamp["main.tree"] = "tree"
+	if _, err := GoBuildCommand(opts); err == nil {
+		t.Fatal("expected error for unknown field")
+	}
+
+	opts.Git = nil
+	opts.Stamp = map[string]string{"main.version": "version"}
+	if _, err := GoBuildCommand(opts); err == nil {
+		t.Fatal("expected error without git information")
+	}
+}
+
+func TestGoBuildCommand_templates(t *testing.T) {
+	opts := &CompileOpts{
+		PackagePath: "example.com/foo",
+		Platform:    Platform{OS: "linux", Arch: "arm64"},
+		OutputTpl:   "{{.Dir}}",
+		Gcflags:     "{{.ImportPath}}=-N -l",
+		Ldflags:     "-X main.platform={{.OS}}/{{.Arch}} -X main.edition={{.Env.EDITION}}{{.Env.GOX_UNSET_VARIABLE}}",
+		Asmflags:    "-D GOOS_{{.OS}}",
+		Tags:        `netgo{{if eq .OS "linux"}},osusergo{{end}}`,
+		Env:         []string{"EDITION=pro"},
+		GoCmd:       "go",
+	}
+
+	cmd, err := GoBuildCommand(opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []string{
+		"build",
+		"-gcflags", "example.com/foo=-N -l",
+		"-ldflags", "-X main.platform=linux/arm64 -X main.edition=pro",
+		"-asmflags", "-D GOOS_linux",
+		"-tags", "netgo,osusergo",
+		"-o", cmd.Output, "example.com/foo",
+	}
+	if !reflect.DeepEqual(cmd.Args, expected) {
+		t.Fatalf("bad: %#v", cmd.Args)
+	}
+
+	opts.Tags = "{{.OS"
+	if _, err := GoBuildCommand(opts); err == nil || !strings.Contains(err.Error(), "invalid tags template") {
+		t.Fatalf("bad: %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package gox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"text/template"
+)
+
+// HookTemplateData is the data for the templates of hook commands. It has
+// the fields of OutputTemplateData as well.
+type HookTemplateData struct {
+	OutputTemplateData
+
+	// Package is the import path of the package being built.
+	Package string
+
+	// Output is the absolute path to the binary. It doesn't exist yet
+	// when pre-build hooks run.
+	Output string
+}
+
+// ValidateHook returns an error if the hook isn't a valid template.
+func ValidateHook(hook string) error {
+	_, err := template.New("hook").Parse(hook)
+	return err
+}
+
+// RunHook runs a hook command for the build of cmd. The hook is a template
+// executed with data and the result is run by the shell, sh on Unix and
+// cmd on Windows, with the environment of the build in dir, the directory
+// of the package. Its output is written to log, if it isn't nil, and is in
+// the error if the hook fails.
+func RunHook(ctx context.Context, hook string, dir string, cmd *BuildCommand, data *HookTemplateData, log io.Writer) error {
+	command, err := executeTemplate("hook", hook, data)
+	if err != nil {
+		return err
+	}
+
+	shell := exec.CommandContext(ctx, "sh", "-c", command)
+	if runtime.GOOS == "windows" {
+		shell = exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	killProcessGroup(shell)
+	shell.Env = append(os.Environ(), cmd.Env...)
+	shell.Dir = dir
+
+	var output bytes.Buffer
+	shell.Stdout = &output
+	shell.Stderr = &output
+	if log != nil {
+		shell.Stdout = io.MultiWriter(&output, log)
+		shell.Stderr = shell.Stdout
+	}
+
+	if err := shell.Run(); err != nil {
+		return fmt.Errorf("hook %q: %w", command, &execError{Err: err, Stderr: output.String()})
+	}
+
+	return nil
+}
+
+// newHookTemplateData returns the data for the hooks of the job, which is
+// built by cmd.
+func newHookTemplateData(job *Job, cmd *BuildCommand) *HookTemplateData {
+	return &HookTemplateData{
+		OutputTemplateData: NewOutputTemplateData(job.Opts),
+		Package:            job.Package,
+		Output:             cmd.Output,
+	}
+}
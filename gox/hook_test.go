@@ -0,0 +1,106 @@
+package gox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRunHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+
+	td := t.TempDir()
+	cmd := &BuildCommand{
+		Env:    []string{"GOOS=linux", "GOARCH=arm"},
+		Output: filepath.Join(td, "foo_linux_arm"),
+	}
+	data := &HookTemplateData{
+		OutputTemplateData: OutputTemplateData{Dir: "foo", OS: "linux", Arch: "arm", Variant: "7"},
+		Package:            "example.com/foo",
+		Output:             cmd.Output,
+	}
+
+	var log bytes.Buffer
+	hook := `echo "{{.Package}} {{.OS}}/{{.Arch}}/{{.Variant}} $GOARCH" > {{.Output}}.txt && echo done`
+	if err := RunHook(context.Background(), hook, td, cmd, data, &log); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if log.String() != "done\n" {
+		t.Fatalf("bad: %q", log.String())
+	}
+
+	out, err := os.ReadFile(cmd.Output + ".txt")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(out) != "example.com/foo linux/arm/7 arm\n" {
+		t.Fatalf("bad: %q", out)
+	}
+
+	err = RunHook(context.Background(), "echo oops >&2; exit 3", td, cmd, data, nil)
+
+	var execErr *execError
+	if !errors.As(err, &execErr) {
+		t.Fatalf("bad: %#v", err)
+	}
+	if execErr.ExitCode() != 3 || execErr.Stderr != "oops\n" {
+		t.Fatalf("bad: %#v", execErr)
+	}
+	if !strings.HasPrefix(err.Error(), `hook "echo oops >&2; exit 3": exit status 3`) {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestBuilder_hookDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+
+	td := testModule(t, map[string]string{})
+	dir := filepath.Join(td, "cmd", "app")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The hooks run in the directory of the package, not in the current
+	// one.
+	b := &Builder{Parallel: 1, PostHooks: []string{"pwd > {{.Output}}.pwd"}}
+	jobs, err := b.Plan([]string{"example.com/app/cmd/app"}, []Platform{{OS: "linux", Arch: "amd64"}}, func(pkg string, platform Platform) (*CompileOpts, error) {
+		return &CompileOpts{
+			PackagePath: pkg,
+			Platform:    platform,
+			OutputTpl:   filepath.Join(td, DefaultOutputTpl),
+			GoCmd:       "go",
+		}, nil
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	results := b.Build(context.Background(), jobs)
+	if results[0].Err != nil {
+		t.Fatalf("err: %s", results[0].Err)
+	}
+
+	out, err := os.ReadFile(results[0].Artifacts[0].Path + ".pwd")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if got, _ := filepath.EvalSymlinks(strings.TrimSpace(string(out))); got != expected {
+		t.Fatalf("bad: %q", out)
+	}
+}
@@ -0,0 +1,201 @@
+package gox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// Artifact is a single file produced by a build, either the binary itself,
+// an archive of it or an SBOM of it.
+type Artifact struct {
+	// Type is "binary", "archive" or "sbom".
+	Type string `json:"type"`
+
+	ImportPath string `json:"import_path"`
+	OS         string `json:"os"`
+	Arch       string `json:"arch"`
+	Variant    string `json:"variant,omitempty"`
+	Path       string `json:"path"`
+
+	// Size and Checksum are filled in by WriteManifest. The checksum is
+	// prefixed with the algorithm, e.g. "sha256:...".
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum"`
+
+	// Duration is the time it took to build the binary.
+	Duration time.Duration `json:"duration_ns"`
+
+	// The effective build options once the overrides have been applied.
+	Ldflags   string `json:"ldflags,omitempty"`
+	Gcflags   string `json:"gcflags,omitempty"`
+	Asmflags  string `json:"asmflags,omitempty"`
+	Tags      string `json:"tags,omitempty"`
+	Cgo       bool   `json:"cgo"`
+	GoVersion string `json:"go_version"`
+
+	// SBOMs are the SBOMs of a binary, which are also artifacts of their
+	// own.
+	SBOMs []SBOMFile `json:"sboms,omitempty"`
+}
+
+// SBOMFile is an SBOM of a binary in one of SBOMFormats.
+type SBOMFile struct {
+	Format string `json:"format"`
+	Path   string `json:"path"`
+}
+
+// NewArtifact returns the artifact at path built using opts. Its flags
+// are those go build was run with, as returned by GoBuildCommand.
+func NewArtifact(kind string, importPath string, path string, opts *CompileOpts, duration time.Duration, goVersion string) Artifact {
+	artifact := Artifact{
+		Type:       kind,
+		ImportPath: importPath,
+		OS:         opts.Platform.OS,
+		Arch:       opts.Platform.Arch,
+		Variant:    opts.Platform.Variant,
+		Path:       path,
+		Duration:   duration,
+		Ldflags:    opts.Ldflags,
+		Gcflags:    opts.Gcflags,
+		Asmflags:   opts.Asmflags,
+		Tags:       opts.Tags,
+		Cgo:        opts.Cgo,
+		GoVersion:  goVersion,
+	}
+
+	// The options were already built with, so the command can only fail
+	// for options that weren't, which are recorded as they are.
+	if cmd, err := GoBuildCommand(opts); err == nil {
+		artifact.Ldflags = cmd.Ldflags
+		artifact.Gcflags = cmd.Gcflags
+		artifact.Asmflags = cmd.Asmflags
+		artifact.Tags = cmd.Tags
+	}
+
+	return artifact
+}
+
+// Manifest is the machine-readable record of everything built in a run.
+type Manifest struct {
+	Artifacts []Artifact `json:"artifacts"`
+}
+
+// WriteManifest writes a JSON manifest of the artifacts to path, filling
+// in the size and checksum of each using the given algorithm.
+func WriteManifest(path string, algo string, artifacts []Artifact) error {
+	manifest := Manifest{
+		Artifacts: make([]Artifact, 0, len(artifacts)),
+	}
+
+	for _, a := range artifacts {
+		info, err := os.Stat(a.Path)
+		if err != nil {
+			return err
+		}
+
+		sum, err := ChecksumFile(a.Path, algo)
+		if err != nil {
+			return err
+		}
+
+		a.Size = info.Size()
+		a.Checksum = algo + ":" + sum
+		manifest.Artifacts = append(manifest.Artifacts, a)
+	}
+
+	// Builds finish in any order, so sort to keep the manifest stable.
+	sort.SliceStable(manifest.Artifacts, func(i, j int) bool {
+		a, b := manifest.Artifacts[i], manifest.Artifacts[j]
+		if a.ImportPath != b.ImportPath {
+			return a.ImportPath < b.ImportPath
+		}
+		if a.OS != b.OS {
+			return a.OS < b.OS
+		}
+		if a.Arch != b.Arch {
+			return a.Arch < b.Arch
+		}
+		if a.Variant != b.Variant {
+			return a.Variant < b.Variant
+		}
+		return a.Type > b.Type
+	})
+
+	data, err := json.MarshalIndent(&manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// ReadManifest reads a manifest written by WriteManifest.
+func ReadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	return &manifest, nil
+}
+
+// SizeDelta is the change in size of a binary since a previous build.
+type SizeDelta struct {
+	Artifact Artifact
+	OldSize  int64
+	Size     int64
+}
+
+// Growth returns the change in size as a percentage of the old size.
+func (d *SizeDelta) Growth() float64 {
+	if d.OldSize == 0 {
+		return 0
+	}
+
+	return float64(d.Size-d.OldSize) / float64(d.OldSize) * 100
+}
+
+// CompareManifest returns the change in size of each binary in artifacts
+// that is also in the previous manifest, matched by the import path and
+// platform. Binaries that weren't in the previous manifest are left out.
+func CompareManifest(previous *Manifest, artifacts []Artifact) ([]SizeDelta, error) {
+	key := func(a *Artifact) string {
+		return a.ImportPath + " " + a.OS + "/" + a.Arch + "/" + a.Variant
+	}
+
+	oldSizes := make(map[string]int64, len(previous.Artifacts))
+	for _, a := range previous.Artifacts {
+		if a.Type == "binary" {
+			oldSizes[key(&a)] = a.Size
+		}
+	}
+
+	deltas := make([]SizeDelta, 0, len(artifacts))
+	for _, a := range artifacts {
+		if a.Type != "binary" {
+			continue
+		}
+
+		oldSize, ok := oldSizes[key(&a)]
+		if !ok {
+			continue
+		}
+
+		info, err := os.Stat(a.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		deltas = append(deltas, SizeDelta{Artifact: a, OldSize: oldSize, Size: info.Size()})
+	}
+
+	return deltas, nil
+}
@@ -0,0 +1,110 @@
+package gox
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWriteManifest(t *testing.T) {
+	td := t.TempDir()
+
+	binary := filepath.Join(td, "foo_linux_amd64")
+	archive := binary + ".tar.gz"
+	for _, path := range []string{binary, archive} {
+		if err := os.WriteFile(path, []byte("hello\n"), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	opts := &CompileOpts{
+		Platform: Platform{OS: "linux", Arch: "amd64"},
+		Ldflags:  "-s -w",
+		Tags:     "netgo",
+		Cgo:      true,
+	}
+	artifacts := []Artifact{
+		NewArtifact("archive", "example.com/foo", archive, opts, time.Second, "go1.23.0"),
+		NewArtifact("binary", "example.com/foo", binary, opts, time.Second, "go1.23.0"),
+	}
+
+	path := filepath.Join(td, "artifacts.json")
+	if err := WriteManifest(path, "sha256", artifacts); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	sum := "sha256:5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+	expected := []Artifact{artifacts[1], artifacts[0]}
+	for i := range expected {
+		expected[i].Size = 6
+		expected[i].Checksum = sum
+	}
+
+	if !reflect.DeepEqual(manifest.Artifacts, expected) {
+		t.Fatalf("bad: %#v", manifest.Artifacts)
+	}
+}
+
+func TestNewArtifact(t *testing.T) {
+	opts := &CompileOpts{
+		PackagePath: "example.com/foo",
+		Platform:    Platform{OS: "linux", Arch: "amd64"},
+		OutputTpl:   DefaultOutputTpl,
+		Ldflags:     "-s -X main.os={{.OS}}",
+		Gcflags:     "all=-N",
+		Tags:        "netgo {{.Arch}}",
+		Git:         &GitInfo{Version: "v1.0.0"},
+		Stamp:       map[string]string{"main.version": "version"},
+	}
+
+	artifact := NewArtifact("binary", "example.com/foo", "foo_linux_amd64", opts, time.Second, "go1.23.0")
+	if artifact.Ldflags != "-s -X main.os=linux -X main.version=v1.0.0" || artifact.Gcflags != "all=-N" || artifact.Tags != "netgo amd64" {
+		t.Fatalf("bad: %#v", artifact)
+	}
+}
+
+func TestCompareManifest(t *testing.T) {
+	td := t.TempDir()
+
+	binary := filepath.Join(td, "foo_linux_amd64")
+	if err := os.WriteFile(binary, make([]byte, 150), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	opts := &CompileOpts{Platform: Platform{OS: "linux", Arch: "amd64"}}
+	artifacts := []Artifact{
+		NewArtifact("binary", "example.com/foo", binary, opts, time.Second, "go1.23.0"),
+		NewArtifact("archive", "example.com/foo", binary+".zip", opts, time.Second, "go1.23.0"),
+		NewArtifact("binary", "example.com/bar", binary, opts, time.Second, "go1.23.0"),
+	}
+
+	previous := &Manifest{Artifacts: []Artifact{
+		{Type: "binary", ImportPath: "example.com/foo", OS: "linux", Arch: "amd64", Size: 100},
+		{Type: "binary", ImportPath: "example.com/foo", OS: "linux", Arch: "arm", Size: 100},
+	}}
+
+	deltas, err := CompareManifest(previous, artifacts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(deltas) != 1 || deltas[0].OldSize != 100 || deltas[0].Size != 150 {
+		t.Fatalf("bad: %#v", deltas)
+	}
+	if deltas[0].Growth() != 50 {
+		t.Fatalf("bad: %f", deltas[0].Growth())
+	}
+}
@@ -0,0 +1,111 @@
+package gox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// OptsFactory returns the options of every build for Builder.Plan, see
+// New. The version information of the repository of a package is only
+// read if a build of it uses it, and then only once.
+type OptsFactory struct {
+	// Base are the options that every build starts from, with its
+	// package and platform set.
+	Base CompileOpts
+
+	// Package, if it isn't nil, sets the options of the package, such as
+	// its size budget, before the overrides for the platform are applied.
+	Package func(opts *CompileOpts) error
+
+	// Overrides, if it isn't nil, applies the overrides for a level of
+	// the platform before those of the environment, see ApplyOverrides.
+	Overrides func(opts *CompileOpts, level []string) error
+
+	// Templates are the templates executed for every build other than
+	// those of the options, such as those of the hooks, see
+	// Builder.Templates. The version information is read for the builds
+	// that use it in any template, those that stamp it into the binary
+	// and those of Windows binaries when WindowsResources is set, since
+	// their version defaults to it.
+	Templates        []string
+	WindowsResources bool
+
+	// Warn is called, if it isn't nil, with the error reading the version
+	// information when it is optional, other than when the package isn't
+	// in a git repository.
+	Warn func(err error)
+
+	dirs map[string]string
+	git  map[string]gitResult
+}
+
+// gitResult is the version information of a repository, or the error
+// reading it.
+type gitResult struct {
+	info *GitInfo
+	err  error
+}
+
+// New returns the options of the build of the package for the platform.
+func (f *OptsFactory) New(pkg string, platform Platform) (*CompileOpts, error) {
+	opts := f.Base
+	opts.PackagePath = pkg
+	opts.Platform = platform
+	opts.Env = append([]string(nil), f.Base.Env...)
+
+	if f.Package != nil {
+		if err := f.Package(&opts); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := ApplyOverrides(&opts, f.Overrides); err != nil {
+		return nil, err
+	}
+
+	resources := f.WindowsResources && platform.OS == "windows"
+	if len(opts.Stamp) > 0 || resources || UsesGitInfo(append(f.Templates,
+		opts.OutputTpl, opts.Ldflags, opts.Gcflags, opts.Asmflags, opts.Tags)...) {
+		var err error
+		if opts.Git, err = f.gitInfo(&opts); err != nil {
+			return nil, err
+		}
+	}
+
+	return &opts, nil
+}
+
+// gitInfo returns the version information of the repository of the
+// package of opts, read once for the directory of the package. It is
+// optional, unless it has to be stamped into the binary.
+func (f *OptsFactory) gitInfo(opts *CompileOpts) (*GitInfo, error) {
+	if f.dirs == nil {
+		f.dirs = make(map[string]string)
+		f.git = make(map[string]gitResult)
+	}
+
+	dir, ok := f.dirs[opts.PackagePath]
+	if !ok {
+		var err error
+		if dir, err = PackageDir(context.Background(), opts.PackagePath, opts.GoCmd); err != nil {
+			return nil, err
+		}
+		f.dirs[opts.PackagePath] = dir
+	}
+
+	result, ok := f.git[dir]
+	if !ok {
+		result.info, result.err = ReadGitInfo(dir)
+		f.git[dir] = result
+
+		if result.err != nil && len(opts.Stamp) == 0 && f.Warn != nil && !errors.Is(result.err, ErrNotGitRepository) {
+			f.Warn(result.err)
+		}
+	}
+	if result.err != nil && len(opts.Stamp) > 0 {
+		return nil, fmt.Errorf("error reading git information to stamp: %s", result.err)
+	}
+
+	return result.info, nil
+}
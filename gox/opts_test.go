@@ -0,0 +1,57 @@
+package gox
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOptsFactory(t *testing.T) {
+	t.Setenv("GOX_LINUX_ENV_FOO", "env")
+
+	f := &OptsFactory{
+		Base: CompileOpts{
+			OutputTpl: DefaultOutputTpl,
+			Ldflags:   "-s",
+			MaxSize:   1,
+			Env:       []string{"FOO=base"},
+		},
+		Package: func(opts *CompileOpts) error {
+			if opts.PackagePath == "example.com/foo" {
+				opts.MaxSize = 2
+			}
+			return nil
+		},
+		Overrides: func(opts *CompileOpts, level []string) error {
+			if reflect.DeepEqual(level, []string{"linux", "arm"}) {
+				return ApplyOverride(opts, "LDFLAGS", "+-w")
+			}
+			return nil
+		},
+	}
+
+	opts, err := f.New("example.com/foo", Platform{OS: "linux", Arch: "arm"})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := &CompileOpts{
+		PackagePath: "example.com/foo",
+		Platform:    Platform{OS: "linux", Arch: "arm"},
+		OutputTpl:   DefaultOutputTpl,
+		Ldflags:     "-s -w",
+		MaxSize:     2,
+		Env:         []string{"FOO=env"},
+	}
+	if !reflect.DeepEqual(opts, expected) {
+		t.Fatalf("bad: %#v", opts)
+	}
+
+	// The overrides of one build don't leak into the base of the others.
+	opts, err = f.New("example.com/bar", Platform{OS: "darwin", Arch: "arm64"})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if opts.Ldflags != "-s" || opts.MaxSize != 1 || !reflect.DeepEqual(opts.Env, []string{"FOO=base"}) {
+		t.Fatalf("bad: %#v", opts)
+	}
+}
@@ -0,0 +1,396 @@
+package gox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+)
+
+// Platform is a combination of OS/arch that can be built against.
+type Platform struct {
+	OS   string
+	Arch string
+
+	// Variant is the optional architecture variant, such as "7" for
+	// linux/arm/7 or "v3" for linux/amd64/v3. It is exported to the build
+	// as the variant environment variable of the arch, e.g. GOARM.
+	Variant string
+
+	// Default, if true, will be included as a default build target
+	// if no OS/arch is specified. We try to only set as a default popular
+	// targets or targets that are generally useful. For example, Android
+	// is not a default because it is quite rare that you're cross-compiling
+	// something to Android AND something like Linux.
+	Default bool
+
+	// FirstClass and CgoSupported mirror the fields of the same name
+	// reported by `go tool dist list -json`. They are only populated when
+	// the platform list was read from the toolchain.
+	FirstClass   bool
+	CgoSupported bool
+}
+
+func (p *Platform) String() string {
+	if p.Variant != "" {
+		return fmt.Sprintf("%s/%s/%s", p.OS, p.Arch, p.Variant)
+	}
+
+	return fmt.Sprintf("%s/%s", p.OS, p.Arch)
+}
+
+// OSArch returns the os/arch pair of the platform without the variant.
+func (p *Platform) OSArch() string {
+	return fmt.Sprintf("%s/%s", p.OS, p.Arch)
+}
+
+// VariantEnv returns the environment variable that selects the variant
+// for the arch of the platform, or an empty string if it has none.
+func (p *Platform) VariantEnv() string {
+	return archVariants[p.Arch].env
+}
+
+// ValidateVariant returns an error if the variant of the platform isn't
+// one that its arch allows.
+func (p *Platform) ValidateVariant() error {
+	if p.Variant == "" {
+		return nil
+	}
+
+	variants, ok := archVariants[p.Arch]
+	if !ok {
+		return fmt.Errorf("%s: arch %s has no variants", p.String(), p.Arch)
+	}
+
+	for _, v := range variants.values {
+		if p.Variant == v {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%s: invalid %s value %q, must be one of: %s",
+		p.String(), variants.env, p.Variant, strings.Join(variants.values, ", "))
+}
+
+// archVariants are the environment variables and allowed values that
+// select the variant of each arch.
+var archVariants = map[string]struct {
+	env    string
+	values []string
+}{
+	"386":      {"GO386", []string{"sse2", "softfloat"}},
+	"amd64":    {"GOAMD64", []string{"v1", "v2", "v3", "v4"}},
+	"arm":      {"GOARM", []string{"5", "6", "7", "5,softfloat", "6,softfloat", "7,softfloat", "5,hardfloat", "6,hardfloat", "7,hardfloat"}},
+	"mips":     {"GOMIPS", []string{"hardfloat", "softfloat"}},
+	"mipsle":   {"GOMIPS", []string{"hardfloat", "softfloat"}},
+	"mips64":   {"GOMIPS64", []string{"hardfloat", "softfloat"}},
+	"mips64le": {"GOMIPS64", []string{"hardfloat", "softfloat"}},
+	"ppc64":    {"GOPPC64", []string{"power8", "power9", "power10"}},
+	"ppc64le":  {"GOPPC64", []string{"power8", "power9", "power10"}},
+	"riscv64":  {"GORISCV64", []string{"rva20u64", "rva22u64", "rva23u64"}},
+}
+
+// addDrop appends all of the "add" entries and drops the "drop" entries, ignoring
+// the "Default" parameter.
+func addDrop(base []Platform, add []Platform, drop []Platform) []Platform {
+	newPlatforms := make([]Platform, len(base)+len(add))
+	copy(newPlatforms, base)
+	copy(newPlatforms[len(base):], add)
+
+	// slow, but we only do this during initialization at most once per version
+	for _, platform := range drop {
+		found := -1
+		for i := range newPlatforms {
+			if newPlatforms[i].Arch == platform.Arch && newPlatforms[i].OS == platform.OS {
+				found = i
+				break
+			}
+		}
+		if found < 0 {
+			panic(fmt.Sprintf("Expected to remove %+v but not found in list %+v", platform, newPlatforms))
+		}
+		if found == len(newPlatforms)-1 {
+			newPlatforms = newPlatforms[:found]
+		} else if found == 0 {
+			newPlatforms = newPlatforms[found:]
+		} else {
+			newPlatforms = append(newPlatforms[:found], newPlatforms[found+1:]...)
+		}
+	}
+	return newPlatforms
+}
+
+var (
+	Platforms_1_0 = []Platform{
+		{OS: "darwin", Arch: "386", Default: true},
+		{OS: "darwin", Arch: "amd64", Default: true},
+		{OS: "linux", Arch: "386", Default: true},
+		{OS: "linux", Arch: "amd64", Default: true},
+		{OS: "linux", Arch: "arm", Default: true},
+		{OS: "freebsd", Arch: "386", Default: true},
+		{OS: "freebsd", Arch: "amd64", Default: true},
+		{OS: "openbsd", Arch: "386", Default: true},
+		{OS: "openbsd", Arch: "amd64", Default: true},
+		{OS: "windows", Arch: "386", Default: true},
+		{OS: "windows", Arch: "amd64", Default: true},
+	}
+
+	Platforms_1_1 = addDrop(Platforms_1_0, []Platform{
+		{OS: "freebsd", Arch: "arm", Default: true},
+		{OS: "netbsd", Arch: "386", Default: true},
+		{OS: "netbsd", Arch: "amd64", Default: true},
+		{OS: "netbsd", Arch: "arm", Default: true},
+		{OS: "plan9", Arch: "386", Default: false},
+	}, nil)
+
+	Platforms_1_3 = addDrop(Platforms_1_1, []Platform{
+		{OS: "dragonfly", Arch: "386", Default: false},
+		{OS: "dragonfly", Arch: "amd64", Default: false},
+		{OS: "nacl", Arch: "amd64", Default: false},
+		{OS: "nacl", Arch: "amd64p32", Default: false},
+		{OS: "nacl", Arch: "arm", Default: false},
+		{OS: "solaris", Arch: "amd64", Default: false},
+	}, nil)
+
+	Platforms_1_4 = addDrop(Platforms_1_3, []Platform{
+		{OS: "android", Arch: "arm", Default: false},
+		{OS: "plan9", Arch: "amd64", Default: false},
+	}, nil)
+
+	Platforms_1_5 = addDrop(Platforms_1_4, []Platform{
+		{OS: "darwin", Arch: "arm", Default: false},
+		{OS: "darwin", Arch: "arm64", Default: false},
+		{OS: "linux", Arch: "arm64", Default: false},
+		{OS: "linux", Arch: "ppc64", Default: false},
+		{OS: "linux", Arch: "ppc64le", Default: false},
+	}, nil)
+
+	Platforms_1_6 = addDrop(Platforms_1_5, []Platform{
+		{OS: "android", Arch: "386", Default: false},
+		{OS: "android", Arch: "amd64", Default: false},
+		{OS: "linux", Arch: "mips64", Default: false},
+		{OS: "linux", Arch: "mips64le", Default: false},
+		{OS: "nacl", Arch: "386", Default: false},
+		{OS: "openbsd", Arch: "arm", Default: true},
+	}, nil)
+
+	Platforms_1_7 = addDrop(Platforms_1_5, []Platform{
+		// While not fully supported s390x is generally useful
+		{OS: "linux", Arch: "s390x", Default: true},
+		{OS: "plan9", Arch: "arm", Default: false},
+		// Add the 1.6 Platforms, but reflect full support for mips64 and mips64le
+		{OS: "android", Arch: "386", Default: false},
+		{OS: "android", Arch: "amd64", Default: false},
+		{OS: "linux", Arch: "mips64", Default: true},
+		{OS: "linux", Arch: "mips64le", Default: true},
+		{OS: "nacl", Arch: "386", Default: false},
+		{OS: "openbsd", Arch: "arm", Default: true},
+	}, nil)
+
+	Platforms_1_8 = addDrop(Platforms_1_7, []Platform{
+		{OS: "linux", Arch: "mips", Default: true},
+		{OS: "linux", Arch: "mipsle", Default: true},
+	}, nil)
+
+	// no new platforms in 1.9
+	Platforms_1_9 = Platforms_1_8
+
+	// unannounced, but dropped support for android/amd64
+	Platforms_1_10 = addDrop(Platforms_1_9, nil, []Platform{
+		{OS: "android", Arch: "amd64", Default: false},
+	})
+
+	Platforms_1_11 = addDrop(Platforms_1_10, []Platform{
+		{OS: "js", Arch: "wasm", Default: true},
+	}, nil)
+
+	Platforms_1_12 = addDrop(Platforms_1_11, []Platform{
+		{OS: "aix", Arch: "ppc64", Default: false},
+		{OS: "windows", Arch: "arm", Default: true},
+	}, nil)
+
+	Platforms_1_13 = addDrop(Platforms_1_12, []Platform{
+		{OS: "illumos", Arch: "amd64", Default: false},
+		{OS: "netbsd", Arch: "arm64", Default: true},
+		{OS: "openbsd", Arch: "arm64", Default: true},
+	}, nil)
+
+	Platforms_1_14 = addDrop(Platforms_1_13, []Platform{
+		{OS: "freebsd", Arch: "arm64", Default: true},
+		{OS: "linux", Arch: "riscv64", Default: true},
+	}, []Platform{
+		// drop nacl
+		{OS: "nacl", Arch: "386", Default: false},
+		{OS: "nacl", Arch: "amd64", Default: false},
+		{OS: "nacl", Arch: "arm", Default: false},
+	})
+
+	Platforms_1_15 = addDrop(Platforms_1_14, []Platform{
+		{OS: "android", Arch: "arm64", Default: false},
+	}, []Platform{
+		// drop i386 macos
+		{OS: "darwin", Arch: "386", Default: false},
+	})
+
+	Platforms_1_16 = addDrop(Platforms_1_15, []Platform{
+		{OS: "android", Arch: "amd64", Default: false},
+		{OS: "darwin", Arch: "arm64", Default: true},
+		{OS: "openbsd", Arch: "mips64", Default: false},
+	}, nil)
+
+	Platforms_1_17 = addDrop(Platforms_1_16, []Platform{
+		{OS: "windows", Arch: "arm64", Default: true},
+	}, nil)
+
+	// no new platforms in 1.18
+	Platforms_1_18 = Platforms_1_17
+
+	Platforms_1_19 = addDrop(Platforms_1_18, []Platform{
+		{OS: "linux", Arch: "loong64", Default: true},
+	}, nil)
+
+	Platforms_1_20 = Platforms_1_19
+
+	Platforms_1_21 = Platforms_1_20
+
+	Platforms_1_22 = addDrop(Platforms_1_21, []Platform{
+		{OS: "openbsd", Arch: "riscv64", Default: false},
+	}, nil)
+
+	Platforms_1_23 = addDrop(Platforms_1_22, []Platform{
+		{OS: "openbsd", Arch: "ppc64", Default: false},
+	}, nil)
+
+	PlatformsLatest = Platforms_1_23
+)
+
+// SupportedPlatforms returns the full list of supported platforms for
+// the version of Go that is given, using the static tables above.
+func SupportedPlatforms(v string) []Platform {
+	// Use latest if we get an unexpected version string
+	if !strings.HasPrefix(v, "go") {
+		return PlatformsLatest
+	}
+	// go-version only cares about version numbers
+	v = v[2:]
+
+	current, err := version.NewVersion(v)
+	if err != nil {
+		log.Printf("Unable to parse current go version: %s\n%s", v, err.Error())
+
+		// Default to latest
+		return PlatformsLatest
+	}
+
+	var platforms = []struct {
+		constraint string
+		plat       []Platform
+	}{
+		{"<= 1.0", Platforms_1_0},
+		{">= 1.1, < 1.3", Platforms_1_1},
+		{">= 1.3, < 1.4", Platforms_1_3},
+		{">= 1.4, < 1.5", Platforms_1_4},
+		{">= 1.5, < 1.6", Platforms_1_5},
+		{">= 1.6, < 1.7", Platforms_1_6},
+		{">= 1.7, < 1.8", Platforms_1_7},
+		{">= 1.8, < 1.9", Platforms_1_8},
+		{">= 1.9, < 1.10", Platforms_1_9},
+		{">= 1.10, < 1.11", Platforms_1_10},
+		{">= 1.11, < 1.12", Platforms_1_11},
+		{">= 1.12, < 1.13", Platforms_1_12},
+		{">= 1.13, < 1.14", Platforms_1_13},
+		{">= 1.14, < 1.15", Platforms_1_14},
+		{">= 1.15, < 1.16", Platforms_1_15},
+		{">= 1.16, < 1.17", Platforms_1_16},
+		{">= 1.17, < 1.18", Platforms_1_17},
+		{">= 1.18, < 1.19", Platforms_1_18},
+		{">= 1.19, < 1.20", Platforms_1_19},
+		{">= 1.20, < 1.21", Platforms_1_20},
+		{">= 1.21, < 1.22", Platforms_1_21},
+		{">= 1.22, < 1.23", Platforms_1_22},
+		{">= 1.23, < 1.24", Platforms_1_23},
+	}
+
+	for _, p := range platforms {
+		constraints, err := version.NewConstraint(p.constraint)
+		if err != nil {
+			panic(err)
+		}
+		if constraints.Check(current) {
+			return p.plat
+		}
+	}
+
+	// Assume latest
+	return PlatformsLatest
+}
+
+// distListPlatform is a single entry of the `go tool dist list -json` output.
+type distListPlatform struct {
+	GOOS         string
+	GOARCH       string
+	CgoSupported bool
+	FirstClass   bool
+}
+
+// ToolchainPlatforms returns the list of supported platforms reported by
+// the toolchain behind goCmd. If the toolchain can't report them (Go 1.11
+// and earlier don't support `go tool dist list -json`) then the static
+// tables for the given version are used instead.
+func ToolchainPlatforms(ctx context.Context, goCmd string, v string) []Platform {
+	output, err := execGo(ctx, goCmd, nil, "", nil, "tool", "dist", "list", "-json")
+	if err != nil {
+		return SupportedPlatforms(v)
+	}
+
+	platforms, err := parseDistList([]byte(output), PlatformsLatest)
+	if err != nil {
+		log.Printf("Unable to parse supported platforms from %s: %s", goCmd, err)
+
+		return SupportedPlatforms(v)
+	}
+
+	return platforms
+}
+
+// parseDistList parses the output of `go tool dist list -json`. Platforms
+// present in known keep their Default value, while new ports are a
+// default only if they're first class.
+func parseDistList(data []byte, known []Platform) ([]Platform, error) {
+	var entries []distListPlatform
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no platforms reported")
+	}
+
+	defaults := make(map[string]bool, len(known))
+	for _, p := range known {
+		defaults[p.String()] = p.Default
+	}
+
+	platforms := make([]Platform, 0, len(entries))
+	for _, e := range entries {
+		p := Platform{
+			OS:           e.GOOS,
+			Arch:         e.GOARCH,
+			FirstClass:   e.FirstClass,
+			CgoSupported: e.CgoSupported,
+		}
+
+		if def, ok := defaults[p.String()]; ok {
+			p.Default = def
+		} else {
+			p.Default = e.FirstClass
+		}
+
+		platforms = append(platforms, p)
+	}
+
+	return platforms, nil
+}
@@ -1,4 +1,4 @@
-package main
+package gox
 
 import (
 	"flag"
@@ -45,8 +45,9 @@ func (p *PlatformFlag) Platforms(supported []Platform) []Platform {
 	for _, v := range p.OSArch {
 		if v.OS[0] == '!' {
 			v = Platform{
-				OS:   v.OS[1:],
-				Arch: v.Arch,
+				OS:      v.OS[1:],
+				Arch:    v.Arch,
+				Variant: v.Variant,
 			}
 
 			ignoreOSArch[v.String()] = v
@@ -60,8 +61,10 @@ func (p *PlatformFlag) Platforms(supported []Platform) []Platform {
 	var prefilter []Platform = nil
 	if len(includeOSArch) > 0 {
 		prefilter = make([]Platform, 0, len(p.Arch)*len(p.OS)+len(includeOSArch))
-		for _, v := range includeOSArch {
-			prefilter = append(prefilter, v)
+		for _, v := range p.OSArch {
+			if v.OS[0] != '!' {
+				prefilter = append(prefilter, v)
+			}
 		}
 	}
 
@@ -106,19 +109,17 @@ func (p *PlatformFlag) Platforms(supported []Platform) []Platform {
 		// Remove any that aren't supported
 		result := make([]Platform, 0, len(prefilter))
 		for _, pending := range prefilter {
-			found := false
 			for _, platform := range supported {
-				if pending.String() == platform.String() {
-					found = true
+				if pending.OSArch() == platform.OSArch() {
+					// Use the supported entry so that the toolchain
+					// capabilities carry over.
+					add := platform
+					add.Variant = pending.Variant
+					add.Default = false
+					result = append(result, add)
 					break
 				}
 			}
-
-			if found {
-				add := pending
-				add.Default = false
-				result = append(result, add)
-			}
 		}
 
 		prefilter = result
@@ -139,9 +140,13 @@ func (p *PlatformFlag) Platforms(supported []Platform) []Platform {
 	result := make([]Platform, 0, len(prefilter))
 	for _, platform := range prefilter {
 		if len(ignoreOSArch) > 0 {
+			// Ignoring an os/arch pair ignores all of its variants too.
 			if _, ok := ignoreOSArch[platform.String()]; ok {
 				continue
 			}
+			if _, ok := ignoreOSArch[platform.OSArch()]; ok {
+				continue
+			}
 		}
 
 		// We only want to check the components (OS and Arch) if we didn't
@@ -200,9 +205,9 @@ func (p *PlatformFlag) OSArchFlagValue() flag.Value {
 	return (*appendPlatformValue)(&p.OSArch)
 }
 
-// appendPlatformValue is a flag.Value that appends a full platform (os/arch)
-// to a list where the values from space-separated lines. This is used to
-// satisfy the -osarch flag.
+// appendPlatformValue is a flag.Value that appends a full platform
+// (os/arch or os/arch/variant) to a list where the values from
+// space-separated lines. This is used to satisfy the -osarch flag.
 type appendPlatformValue []Platform
 
 func (s *appendPlatformValue) String() string {
@@ -216,9 +221,9 @@ func (s *appendPlatformValue) Set(value string) error {
 
 	for _, v := range strings.Split(value, " ") {
 		parts := strings.Split(v, "/")
-		if len(parts) != 2 {
+		if len(parts) != 2 && len(parts) != 3 {
 			return fmt.Errorf(
-				"Invalid platform syntax: %s should be os/arch", v)
+				"Invalid platform syntax: %s should be os/arch or os/arch/variant", v)
 		}
 
 		platform := Platform{
@@ -226,6 +231,14 @@ func (s *appendPlatformValue) Set(value string) error {
 			Arch: strings.ToLower(parts[1]),
 		}
 
+		if len(parts) == 3 {
+			platform.Variant = strings.ToLower(parts[2])
+
+			if err := platform.ValidateVariant(); err != nil {
+				return err
+			}
+		}
+
 		s.appendIfMissing(&platform)
 	}
 
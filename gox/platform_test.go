@@ -1,6 +1,7 @@
-package main
+package gox
 
 import (
+	"context"
 	"reflect"
 	"testing"
 )
@@ -154,3 +155,92 @@ func TestMIPS(t *testing.T) {
 		t.Fatal("Expected to find linux/mips64/true in go1.7 supported platforms")
 	}
 }
+
+func TestParseDistList(t *testing.T) {
+	data := []byte(`[
+	{"GOOS": "linux", "GOARCH": "amd64", "CgoSupported": true, "FirstClass": true},
+	{"GOOS": "plan9", "GOARCH": "386", "CgoSupported": false, "FirstClass": false},
+	{"GOOS": "newos", "GOARCH": "arm64", "CgoSupported": false, "FirstClass": true},
+	{"GOOS": "newos", "GOARCH": "amd64", "CgoSupported": false, "FirstClass": false}
+]`)
+
+	ps, err := parseDistList(data, PlatformsLatest)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []Platform{
+		{OS: "linux", Arch: "amd64", Default: true, FirstClass: true, CgoSupported: true},
+		{OS: "plan9", Arch: "386", Default: false},
+		{OS: "newos", Arch: "arm64", Default: true, FirstClass: true},
+		{OS: "newos", Arch: "amd64", Default: false},
+	}
+	if !reflect.DeepEqual(ps, expected) {
+		t.Fatalf("bad: %#v", ps)
+	}
+
+	if _, err := parseDistList([]byte("[]"), PlatformsLatest); err == nil {
+		t.Fatal("expected error for empty list")
+	}
+
+	if _, err := parseDistList([]byte("linux/amd64"), PlatformsLatest); err == nil {
+		t.Fatal("expected error for non-JSON output")
+	}
+}
+
+func TestToolchainPlatforms(t *testing.T) {
+	ps := ToolchainPlatforms(context.Background(), "go", "go1.23")
+
+	found := false
+	for _, p := range ps {
+		if p.OS == "linux" && p.Arch == "amd64" {
+			found = true
+			if !p.Default || !p.FirstClass || !p.CgoSupported {
+				t.Fatalf("bad: %#v", p)
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("Expected to find linux/amd64 in toolchain platforms: %#v", ps)
+	}
+
+	// A missing toolchain falls back to the static tables
+	ps = ToolchainPlatforms(context.Background(), "gox-missing-go", "go1.10")
+	if !reflect.DeepEqual(ps, Platforms_1_10) {
+		t.Fatalf("bad: %#v", ps)
+	}
+}
+
+func TestPlatformVariant(t *testing.T) {
+	p := Platform{OS: "linux", Arch: "arm", Variant: "7"}
+	if p.String() != "linux/arm/7" || p.OSArch() != "linux/arm" {
+		t.Fatalf("bad: %s %s", p.String(), p.OSArch())
+	}
+	if p.VariantEnv() != "GOARM" {
+		t.Fatalf("bad: %s", p.VariantEnv())
+	}
+	if err := p.ValidateVariant(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cases := []struct {
+		Platform Platform
+		Err      bool
+	}{
+		{Platform{OS: "linux", Arch: "amd64"}, false},
+		{Platform{OS: "linux", Arch: "amd64", Variant: "v3"}, false},
+		{Platform{OS: "linux", Arch: "amd64", Variant: "7"}, true},
+		{Platform{OS: "linux", Arch: "386", Variant: "softfloat"}, false},
+		{Platform{OS: "linux", Arch: "mips64le", Variant: "softfloat"}, false},
+		{Platform{OS: "linux", Arch: "ppc64le", Variant: "power9"}, false},
+		{Platform{OS: "linux", Arch: "riscv64", Variant: "rva22u64"}, false},
+		{Platform{OS: "linux", Arch: "arm64", Variant: "v8.0"}, true},
+	}
+
+	for _, tc := range cases {
+		err := tc.Platform.ValidateVariant()
+		if (err != nil) != tc.Err {
+			t.Errorf("%s: err: %v", tc.Platform.String(), err)
+		}
+	}
+}
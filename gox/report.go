@@ -0,0 +1,250 @@
+package gox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Reporter receives the progress of a run. The methods may be called
+// concurrently by the builds running in parallel.
+type Reporter interface {
+	// Plan is called once the packages and platforms to build are known.
+	Plan(goVersion string, packages []string, platforms []Platform, parallel int)
+
+	// BuildStart and BuildFinish are called around the build of each
+	// package for each platform. err is nil if the build succeeded.
+	BuildStart(pkg string, platform Platform)
+	BuildFinish(pkg string, platform Platform, elapsed time.Duration, err error)
+
+	// BuildSkip is called for a build that was skipped before it started,
+	// or instead of BuildFinish for one that was canceled while running.
+	BuildSkip(pkg string, platform Platform, reason string)
+
+	// Summary is called once every build has finished.
+	Summary(elapsed time.Duration)
+}
+
+// nopReporter is the Reporter that ignores the progress.
+type nopReporter struct{}
+
+func (nopReporter) Plan(goVersion string, packages []string, platforms []Platform, parallel int) {}
+func (nopReporter) BuildStart(pkg string, platform Platform)                                     {}
+func (nopReporter) BuildFinish(pkg string, platform Platform, elapsed time.Duration, err error)  {}
+func (nopReporter) BuildSkip(pkg string, platform Platform, reason string)                       {}
+func (nopReporter) Summary(elapsed time.Duration)                                                {}
+
+// humanReporter is the Reporter for the default human-readable output.
+type humanReporter struct {
+	stdout io.Writer
+	stderr io.Writer
+
+	lock    sync.Mutex
+	errors  []string
+	skipped int
+}
+
+// NewHumanReporter returns the Reporter for the default human-readable
+// output, which prints the progress to stdout and the errors to stderr.
+func NewHumanReporter(stdout, stderr io.Writer) Reporter {
+	return &humanReporter{stdout: stdout, stderr: stderr}
+}
+
+func (r *humanReporter) Plan(goVersion string, packages []string, platforms []Platform, parallel int) {
+	fmt.Fprintf(r.stdout, "Number of parallel builds: %d\n\n", parallel)
+}
+
+func (r *humanReporter) BuildStart(pkg string, platform Platform) {
+	fmt.Fprintf(r.stdout, "--> %15s: %s\n", platform.String(), pkg)
+}
+
+func (r *humanReporter) BuildFinish(pkg string, platform Platform, elapsed time.Duration, err error) {
+	if err == nil {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.errors = append(r.errors,
+		fmt.Sprintf("%s error: %s", platform.String(), err))
+}
+
+func (r *humanReporter) BuildSkip(pkg string, platform Platform, reason string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.skipped++
+}
+
+func (r *humanReporter) Summary(elapsed time.Duration) {
+	if r.skipped > 0 {
+		fmt.Fprintf(r.stderr, "\n%d builds were skipped\n", r.skipped)
+	}
+
+	if len(r.errors) == 0 {
+		return
+	}
+
+	fmt.Fprintf(r.stderr, "\n%d errors occurred:\n", len(r.errors))
+	for _, err := range r.errors {
+		fmt.Fprintf(r.stderr, "--> %s\n", err)
+	}
+}
+
+// Event is a single line of the -json output. The format is stable:
+// fields may be added but won't be removed or change meaning.
+type Event struct {
+	Time   time.Time
+	Action string
+
+	// Package and Platform are set for the events of a single build.
+	Package  string `json:",omitempty"`
+	Platform string `json:",omitempty"`
+
+	// Output is the standard error of a failed build, the error if the
+	// build didn't get as far as running go build, or the reason a build
+	// was skipped.
+	Output string `json:",omitempty"`
+
+	// Elapsed is the time taken in seconds, set for pass, fail and
+	// summary events.
+	Elapsed float64 `json:",omitempty"`
+
+	// ExitCode is the exit status of go build, set for fail events when
+	// go build ran.
+	ExitCode int `json:",omitempty"`
+
+	// Attempts is the number of times the build was attempted and Timeout
+	// is true if the final attempt timed out, set for fail events.
+	Attempts int  `json:",omitempty"`
+	Timeout  bool `json:",omitempty"`
+
+	// GoVersion, Packages, Platforms and Parallel are set for the plan
+	// event.
+	GoVersion string   `json:",omitempty"`
+	Packages  []string `json:",omitempty"`
+	Platforms []string `json:",omitempty"`
+	Parallel  int      `json:",omitempty"`
+
+	// Passed, Failed and Skipped are the number of builds, set for the
+	// summary event.
+	Passed  int `json:",omitempty"`
+	Failed  int `json:",omitempty"`
+	Skipped int `json:",omitempty"`
+}
+
+// jsonReporter is the Reporter for the -json output, which writes one
+// Event per line.
+type jsonReporter struct {
+	lock    sync.Mutex
+	enc     *json.Encoder
+	passed  int
+	failed  int
+	skipped int
+}
+
+// NewJSONReporter returns the Reporter for the -json output, which writes
+// one Event per line to w.
+func NewJSONReporter(w io.Writer) Reporter {
+	return &jsonReporter{enc: json.NewEncoder(w)}
+}
+
+func (r *jsonReporter) emit(e Event) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	e.Time = time.Now()
+	r.enc.Encode(&e)
+}
+
+func (r *jsonReporter) Plan(goVersion string, packages []string, platforms []Platform, parallel int) {
+	names := make([]string, 0, len(platforms))
+	for _, p := range platforms {
+		names = append(names, p.String())
+	}
+
+	r.emit(Event{
+		Action:    "plan",
+		GoVersion: goVersion,
+		Packages:  packages,
+		Platforms: names,
+		Parallel:  parallel,
+	})
+}
+
+func (r *jsonReporter) BuildStart(pkg string, platform Platform) {
+	r.emit(Event{
+		Action:   "start",
+		Package:  pkg,
+		Platform: platform.String(),
+	})
+}
+
+func (r *jsonReporter) BuildFinish(pkg string, platform Platform, elapsed time.Duration, err error) {
+	e := Event{
+		Action:   "pass",
+		Package:  pkg,
+		Platform: platform.String(),
+		Elapsed:  elapsed.Seconds(),
+	}
+
+	if err != nil {
+		output := Event{
+			Action:   "output",
+			Package:  pkg,
+			Platform: platform.String(),
+			Output:   err.Error(),
+		}
+
+		var buildErr *BuildError
+		if errors.As(err, &buildErr) {
+			output.Output = buildErr.Err.Error()
+			e.Attempts = buildErr.Attempts
+			e.Timeout = buildErr.Timeout
+		}
+
+		var execErr *execError
+		if errors.As(err, &execErr) && !e.Timeout {
+			output.Output = execErr.Stderr
+			e.ExitCode = execErr.ExitCode()
+		}
+
+		r.emit(output)
+		e.Action = "fail"
+	}
+
+	r.lock.Lock()
+	if err != nil {
+		r.failed++
+	} else {
+		r.passed++
+	}
+	r.lock.Unlock()
+
+	r.emit(e)
+}
+
+func (r *jsonReporter) BuildSkip(pkg string, platform Platform, reason string) {
+	r.lock.Lock()
+	r.skipped++
+	r.lock.Unlock()
+
+	r.emit(Event{
+		Action:   "skip",
+		Package:  pkg,
+		Platform: platform.String(),
+		Output:   reason,
+	})
+}
+
+func (r *jsonReporter) Summary(elapsed time.Duration) {
+	r.emit(Event{
+		Action:  "summary",
+		Elapsed: elapsed.Seconds(),
+		Passed:  r.passed,
+		Failed:  r.failed,
+		Skipped: r.skipped,
+	})
+}
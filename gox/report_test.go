@@ -0,0 +1,80 @@
+package gox
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSONReporter(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewJSONReporter(&buf)
+
+	linux := Platform{OS: "linux", Arch: "amd64"}
+	arm := Platform{OS: "linux", Arch: "arm", Variant: "7"}
+
+	exitErr := exec.Command("go", "tool", "gox-missing-tool").Run()
+	if exitErr == nil {
+		t.Fatal("expected go tool to fail")
+	}
+
+	r.Plan("go1.23.0", []string{"example.com/foo"}, []Platform{linux, arm}, 2)
+	r.BuildStart("example.com/foo", linux)
+	r.BuildStart("example.com/foo", arm)
+	r.BuildFinish("example.com/foo", linux, time.Second, nil)
+	r.BuildFinish("example.com/foo", arm, 2*time.Second,
+		&execError{Err: exitErr, Stderr: "bad build\n"})
+	r.Summary(3 * time.Second)
+
+	var events []Event
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if e.Time.IsZero() {
+			t.Fatalf("bad: %s", scanner.Text())
+		}
+
+		e.Time = time.Time{}
+		events = append(events, e)
+	}
+
+	expected := []Event{
+		{Action: "plan", GoVersion: "go1.23.0", Packages: []string{"example.com/foo"}, Platforms: []string{"linux/amd64", "linux/arm/7"}, Parallel: 2},
+		{Action: "start", Package: "example.com/foo", Platform: "linux/amd64"},
+		{Action: "start", Package: "example.com/foo", Platform: "linux/arm/7"},
+		{Action: "pass", Package: "example.com/foo", Platform: "linux/amd64", Elapsed: 1},
+		{Action: "output", Package: "example.com/foo", Platform: "linux/arm/7", Output: "bad build\n"},
+		{Action: "fail", Package: "example.com/foo", Platform: "linux/arm/7", Elapsed: 2, ExitCode: 2},
+		{Action: "summary", Elapsed: 3, Passed: 1, Failed: 1},
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Fatalf("bad: %#v", events)
+	}
+}
+
+func TestHumanReporter(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	r := NewHumanReporter(&stdout, &stderr)
+
+	linux := Platform{OS: "linux", Arch: "amd64"}
+	r.Plan("go1.23.0", []string{"example.com/foo"}, []Platform{linux}, 1)
+	r.BuildStart("example.com/foo", linux)
+	r.BuildFinish("example.com/foo", linux, time.Second, errors.New("bad build"))
+	r.Summary(time.Second)
+
+	if !strings.Contains(stdout.String(), "-->     linux/amd64: example.com/foo\n") {
+		t.Fatalf("bad: %s", stdout.String())
+	}
+	if stderr.String() != "\n1 errors occurred:\n--> linux/amd64 error: bad build\n" {
+		t.Fatalf("bad: %q", stderr.String())
+	}
+}
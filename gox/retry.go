@@ -0,0 +1,100 @@
+package gox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// retryBackoff is the delay before the first retry, which doubles
+	// for each retry after it up to retryMaxBackoff.
+	retryBackoff    = time.Second
+	retryMaxBackoff = 30 * time.Second
+)
+
+// RetryOpts are the options for retrying a build.
+type RetryOpts struct {
+	// Timeout is the maximum duration of a single attempt, or zero for
+	// no timeout.
+	Timeout time.Duration
+
+	// Retries is the number of times a failed attempt is retried.
+	Retries int
+}
+
+// BuildError is the error returned by GoCrossCompileRetry once every
+// attempt has failed.
+type BuildError struct {
+	// Err is the error of the final attempt.
+	Err error
+
+	// Attempts is the number of attempts made.
+	Attempts int
+
+	// Timeout is true if the final attempt was killed because it took
+	// longer than the timeout, rather than failing on its own.
+	Timeout bool
+}
+
+func (e *BuildError) Error() string {
+	attempts := ""
+	if e.Attempts > 1 {
+		attempts = fmt.Sprintf(" (after %d attempts)", e.Attempts)
+	}
+
+	if e.Timeout {
+		return "timed out" + attempts
+	}
+
+	return e.Err.Error() + attempts
+}
+
+func (e *BuildError) Unwrap() error {
+	return e.Err
+}
+
+// GoCrossCompileRetry calls GoCrossCompile, retrying with an exponential
+// backoff when it fails or takes longer than the timeout. It doesn't retry
+// once ctx is done.
+func GoCrossCompileRetry(ctx context.Context, opts *CompileOpts, retry RetryOpts) (string, error) {
+	backoff := retryBackoff
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if retry.Timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, retry.Timeout)
+		}
+
+		// GoCrossCompile modifies the options, so give each attempt a
+		// fresh copy and only keep the effective cgo state.
+		attemptOpts := *opts
+		output, err := GoCrossCompile(attemptCtx, &attemptOpts)
+		timeout := errors.Is(attemptCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil
+		cancel()
+		opts.Cgo = attemptOpts.Cgo
+
+		if err == nil {
+			return output, nil
+		}
+
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+
+		if attempt > retry.Retries {
+			return "", &BuildError{Err: err, Attempts: attempt, Timeout: timeout}
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+
+		backoff *= 2
+		if backoff > retryMaxBackoff {
+			backoff = retryMaxBackoff
+		}
+	}
+}
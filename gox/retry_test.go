@@ -0,0 +1,78 @@
+package gox
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGoCrossCompileRetry(t *testing.T) {
+	opts := &CompileOpts{
+		PackagePath: "github.com/authelia/gox",
+		Platform:    Platform{OS: "linux", Arch: "amd64"},
+		OutputTpl:   filepath.Join(t.TempDir(), "gox"),
+		Ldflags:     "-X=bad",
+		GoCmd:       "go",
+	}
+
+	_, err := GoCrossCompileRetry(context.Background(), opts, RetryOpts{Retries: 1})
+
+	var buildErr *BuildError
+	if !errors.As(err, &buildErr) {
+		t.Fatalf("bad: %#v", err)
+	}
+	if buildErr.Attempts != 2 || buildErr.Timeout {
+		t.Fatalf("bad: %#v", buildErr)
+	}
+
+	var execErr *execError
+	if !errors.As(err, &execErr) {
+		t.Fatalf("expected the final exec error, got: %#v", buildErr.Err)
+	}
+
+	// The options are left untouched for the next attempt
+	if opts.PackagePath != "github.com/authelia/gox" || opts.Ldflags != "-X=bad" {
+		t.Fatalf("bad: %#v", opts)
+	}
+}
+
+func TestGoCrossCompileRetry_timeout(t *testing.T) {
+	opts := &CompileOpts{
+		PackagePath: "github.com/authelia/gox",
+		Platform:    Platform{OS: "linux", Arch: "amd64"},
+		OutputTpl:   filepath.Join(t.TempDir(), "gox"),
+		GoCmd:       "go",
+	}
+
+	_, err := GoCrossCompileRetry(context.Background(), opts, RetryOpts{Timeout: time.Nanosecond})
+
+	var buildErr *BuildError
+	if !errors.As(err, &buildErr) {
+		t.Fatalf("bad: %#v", err)
+	}
+	if buildErr.Attempts != 1 || !buildErr.Timeout {
+		t.Fatalf("bad: %#v", buildErr)
+	}
+	if buildErr.Error() != "timed out" {
+		t.Fatalf("bad: %s", buildErr.Error())
+	}
+}
+
+func TestGoCrossCompileRetry_canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	opts := &CompileOpts{
+		PackagePath: "github.com/authelia/gox",
+		Platform:    Platform{OS: "linux", Arch: "amd64"},
+		OutputTpl:   filepath.Join(t.TempDir(), "gox"),
+		GoCmd:       "go",
+	}
+
+	_, err := GoCrossCompileRetry(ctx, opts, RetryOpts{Retries: 3})
+	if err != context.Canceled {
+		t.Fatalf("bad: %#v", err)
+	}
+}
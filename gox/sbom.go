@@ -0,0 +1,364 @@
+package gox
+
+import (
+	"debug/buildinfo"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SBOMFormats are the supported SBOM formats and the extension of the
+// file each is written to, after the name of the binary.
+var SBOMFormats = map[string]string{
+	"cyclonedx": ".cdx.json",
+	"spdx":      ".spdx.json",
+}
+
+// sbomModule is a module of a binary, with the replacement in its place.
+type sbomModule struct {
+	Path    string
+	Version string
+
+	// Sum is the checksum of the module in go.sum, if it has one. Its h1:
+	// hash is of the files of the module rather than of an archive, so it
+	// isn't a SHA-256 checksum of the module.
+	Sum string
+}
+
+// sbomInfo is what an SBOM records about a binary.
+type sbomInfo struct {
+	Name      string
+	SHA256    string
+	Created   time.Time
+	GoVersion string
+	Main      sbomModule
+	Deps      []sbomModule
+	Settings  []debug.BuildSetting
+}
+
+func newSBOMModule(m *debug.Module) sbomModule {
+	if m.Replace != nil {
+		m = m.Replace
+	}
+
+	return sbomModule{Path: m.Path, Version: m.Version, Sum: m.Sum}
+}
+
+// purl returns the package URL of the module.
+func (m *sbomModule) purl() string {
+	segments := strings.Split(m.Path, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+
+	purl := "pkg:golang/" + strings.Join(segments, "/")
+	if m.Version != "" && m.Version != "(devel)" {
+		purl += "@" + url.PathEscape(m.Version)
+	}
+
+	return purl + "?type=module"
+}
+
+// readSBOMInfo reads the build information of the binary at path.
+func readSBOMInfo(path string) (*sbomInfo, error) {
+	info, err := buildinfo.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	sum, err := ChecksumFile(path, "sha256")
+	if err != nil {
+		return nil, err
+	}
+
+	// Like archives, SBOMs are reproducible, so the time they are created
+	// is SOURCE_DATE_EPOCH rather than now.
+	result := &sbomInfo{
+		Name:      filepath.Base(path),
+		SHA256:    sum,
+		Created:   archiveModTime(),
+		GoVersion: info.GoVersion,
+		Main:      newSBOMModule(&info.Main),
+		Settings:  info.Settings,
+	}
+	for _, dep := range info.Deps {
+		result.Deps = append(result.Deps, newSBOMModule(dep))
+	}
+	sort.Slice(result.Deps, func(i, j int) bool {
+		return result.Deps[i].Path < result.Deps[j].Path
+	})
+
+	return result, nil
+}
+
+// WriteSBOM writes an SBOM of the binary at path in the given format, one
+// of SBOMFormats, next to it and returns the path of the SBOM. It lists
+// the main module, every dependency with its version and go.sum checksum,
+// the Go version and the build settings, as read from the build
+// information. The build information of a universal binary is that of
+// its first slice.
+func WriteSBOM(path string, format string) (string, error) {
+	ext, ok := SBOMFormats[format]
+	if !ok {
+		return "", fmt.Errorf("unknown SBOM format: %s", format)
+	}
+
+	info, err := readSBOMInfo(path)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+
+	var doc any
+	switch format {
+	case "cyclonedx":
+		doc = newCycloneDX(info)
+	case "spdx":
+		doc = newSPDX(info)
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	output := path + ext
+	if err := os.WriteFile(output, append(data, '\n'), 0644); err != nil {
+		return "", err
+	}
+
+	return output, nil
+}
+
+// cycloneDX is a CycloneDX 1.5 document, with only what WriteSBOM uses.
+type cycloneDX struct {
+	BOMFormat    string                `json:"bomFormat"`
+	SpecVersion  string                `json:"specVersion"`
+	Version      int                   `json:"version"`
+	Metadata     cycloneDXMetadata     `json:"metadata"`
+	Components   []cycloneDXComponent  `json:"components"`
+	Dependencies []cycloneDXDependency `json:"dependencies"`
+}
+
+type cycloneDXMetadata struct {
+	Timestamp string             `json:"timestamp"`
+	Tools     cycloneDXTools     `json:"tools"`
+	Component cycloneDXComponent `json:"component"`
+}
+
+type cycloneDXTools struct {
+	Components []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXComponent struct {
+	Type       string              `json:"type"`
+	BOMRef     string              `json:"bom-ref,omitempty"`
+	Name       string              `json:"name"`
+	Version    string              `json:"version,omitempty"`
+	PURL       string              `json:"purl,omitempty"`
+	Hashes     []cycloneDXHash     `json:"hashes,omitempty"`
+	Properties []cycloneDXProperty `json:"properties,omitempty"`
+}
+
+type cycloneDXHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cycloneDXDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+// newCycloneDX returns the CycloneDX document of the binary. The binary is
+// the main module, with the hash of the binary, the Go version and the
+// build settings, and the dependencies are its components, with their
+// go.sum checksum as a property.
+func newCycloneDX(info *sbomInfo) *cycloneDX {
+	main := cycloneDXComponent{
+		Type:    "application",
+		BOMRef:  info.Main.purl(),
+		Name:    info.Main.Path,
+		Version: info.Main.Version,
+		PURL:    info.Main.purl(),
+		Hashes:  []cycloneDXHash{{Alg: "SHA-256", Content: info.SHA256}},
+		Properties: []cycloneDXProperty{
+			{Name: "gox:file", Value: info.Name},
+			{Name: "gox:go-version", Value: info.GoVersion},
+		},
+	}
+	for _, s := range info.Settings {
+		main.Properties = append(main.Properties, cycloneDXProperty{Name: "gox:build:" + s.Key, Value: s.Value})
+	}
+
+	doc := &cycloneDX{
+		BOMFormat:   "CycloneDX",
+		SpecVersion: "1.5",
+		Version:     1,
+		Metadata: cycloneDXMetadata{
+			Timestamp: info.Created.Format(time.RFC3339),
+			Tools:     cycloneDXTools{Components: []cycloneDXComponent{{Type: "application", Name: "gox"}}},
+			Component: main,
+		},
+		Components: make([]cycloneDXComponent, 0, len(info.Deps)),
+	}
+
+	dependsOn := make([]string, 0, len(info.Deps))
+	for _, dep := range info.Deps {
+		c := cycloneDXComponent{
+			Type:    "library",
+			BOMRef:  dep.purl(),
+			Name:    dep.Path,
+			Version: dep.Version,
+			PURL:    dep.purl(),
+		}
+		if dep.Sum != "" {
+			c.Properties = []cycloneDXProperty{{Name: "gox:module-sum", Value: dep.Sum}}
+		}
+
+		doc.Components = append(doc.Components, c)
+		dependsOn = append(dependsOn, c.BOMRef)
+	}
+	doc.Dependencies = []cycloneDXDependency{{Ref: main.BOMRef, DependsOn: dependsOn}}
+
+	return doc
+}
+
+// spdx is an SPDX 2.3 document, with only what WriteSBOM uses.
+type spdx struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	SPDXID                string            `json:"SPDXID"`
+	Name                  string            `json:"name"`
+	VersionInfo           string            `json:"versionInfo,omitempty"`
+	PackageFileName       string            `json:"packageFileName,omitempty"`
+	PrimaryPackagePurpose string            `json:"primaryPackagePurpose"`
+	DownloadLocation      string            `json:"downloadLocation"`
+	FilesAnalyzed         bool              `json:"filesAnalyzed"`
+	Checksums             []spdxChecksum    `json:"checksums,omitempty"`
+	ExternalRefs          []spdxExternalRef `json:"externalRefs"`
+	Comment               string            `json:"comment,omitempty"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// newSPDX returns the SPDX document of the binary. The document describes
+// the main module, with the hash of the binary and the Go version and
+// build settings in its comment, which depends on every other module. SPDX
+// has no checksum for the h1: hashes of go.sum, so they are left out.
+func newSPDX(info *sbomInfo) *spdx {
+	newPackage := func(id string, m *sbomModule, purpose string) spdxPackage {
+		p := spdxPackage{
+			SPDXID:                id,
+			Name:                  m.Path,
+			VersionInfo:           m.Version,
+			PrimaryPackagePurpose: purpose,
+			DownloadLocation:      "NOASSERTION",
+			ExternalRefs: []spdxExternalRef{{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  m.purl(),
+			}},
+		}
+
+		return p
+	}
+
+	comment := []string{"go-version=" + info.GoVersion}
+	for _, s := range info.Settings {
+		comment = append(comment, s.Key+"="+s.Value)
+	}
+
+	main := newPackage("SPDXRef-Package-0", &info.Main, "APPLICATION")
+	main.PackageFileName = info.Name
+	main.Checksums = []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: info.SHA256}}
+	main.Comment = strings.Join(comment, "\n")
+
+	// The namespace is unique to the binary, since it is named after its
+	// hash.
+	doc := &spdx{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              info.Name,
+		DocumentNamespace: fmt.Sprintf("https://spdx.org/spdxdocs/%s-%s", url.PathEscape(info.Name), info.SHA256),
+		CreationInfo: spdxCreationInfo{
+			Created:  info.Created.Format(time.RFC3339),
+			Creators: []string{"Tool: gox"},
+		},
+		Packages: []spdxPackage{main},
+		Relationships: []spdxRelationship{{
+			SPDXElementID:      "SPDXRef-DOCUMENT",
+			RelationshipType:   "DESCRIBES",
+			RelatedSPDXElement: main.SPDXID,
+		}},
+	}
+
+	for i, dep := range info.Deps {
+		p := newPackage(fmt.Sprintf("SPDXRef-Package-%d", i+1), &dep, "LIBRARY")
+		doc.Packages = append(doc.Packages, p)
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SPDXElementID:      main.SPDXID,
+			RelationshipType:   "DEPENDS_ON",
+			RelatedSPDXElement: p.SPDXID,
+		})
+	}
+
+	return doc
+}
+
+// writeSBOMs writes the SBOMs of the binary of the job, adds them to the
+// SBOMs of binary and returns them as artifacts.
+func (b *Builder) writeSBOMs(job *Job, binary *Artifact) ([]Artifact, error) {
+	artifacts := make([]Artifact, 0, len(b.SBOM))
+	for _, format := range b.SBOM {
+		path, err := WriteSBOM(binary.Path, format)
+		if err != nil {
+			return artifacts, err
+		}
+
+		binary.SBOMs = append(binary.SBOMs, SBOMFile{Format: format, Path: path})
+		artifacts = append(artifacts, NewArtifact("sbom", job.Package, path, job.Opts, binary.Duration, b.GoVersion))
+	}
+
+	return artifacts, nil
+}
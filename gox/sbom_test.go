@@ -0,0 +1,140 @@
+package gox
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime/debug"
+	"testing"
+)
+
+func TestBuilder_sbom(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	td := testModule(t, map[string]string{})
+	b := &Builder{Parallel: 1, SBOM: []string{"cyclonedx", "spdx"}}
+	jobs, err := b.Plan([]string{"example.com/app"}, []Platform{{OS: "linux", Arch: "arm64"}}, func(pkg string, platform Platform) (*CompileOpts, error) {
+		return &CompileOpts{
+			PackagePath: pkg,
+			Platform:    platform,
+			OutputTpl:   filepath.Join(td, DefaultOutputTpl),
+			GoCmd:       "go",
+			Tags:        "foo",
+		}, nil
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	results := b.Build(context.Background(), jobs)
+	if results[0].Err != nil {
+		t.Fatalf("err: %s", results[0].Err)
+	}
+
+	artifacts := results[0].Artifacts
+	binary := filepath.Join(td, "app_linux_arm64")
+	if len(artifacts) != 3 || artifacts[1].Type != "sbom" || artifacts[1].Path != binary+".cdx.json" ||
+		artifacts[2].Type != "sbom" || artifacts[2].Path != binary+".spdx.json" {
+		t.Fatalf("bad: %#v", artifacts)
+	}
+	expected := []SBOMFile{{"cyclonedx", artifacts[1].Path}, {"spdx", artifacts[2].Path}}
+	if !reflect.DeepEqual(artifacts[0].SBOMs, expected) {
+		t.Fatalf("bad: %#v", artifacts[0].SBOMs)
+	}
+	sum, err := ChecksumFile(binary, "sha256")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var cdx cycloneDX
+	readJSON(t, artifacts[1].Path, &cdx)
+	main := cdx.Metadata.Component
+	if cdx.BOMFormat != "CycloneDX" || cdx.Metadata.Timestamp != "2023-11-14T22:13:20Z" ||
+		main.Name != "example.com/app" || main.PURL != "pkg:golang/example.com/app?type=module" ||
+		main.Hashes[0].Content != sum {
+		t.Fatalf("bad: %#v", cdx)
+	}
+
+	properties := make(map[string]string)
+	for _, p := range main.Properties {
+		properties[p.Name] = p.Value
+	}
+	if properties["gox:build:GOARCH"] != "arm64" || properties["gox:build:-tags"] != "foo" || properties["gox:go-version"] == "" {
+		t.Fatalf("bad: %#v", properties)
+	}
+
+	var doc spdx
+	readJSON(t, artifacts[2].Path, &doc)
+	if doc.SPDXVersion != "SPDX-2.3" || len(doc.Packages) != 1 || doc.Packages[0].Name != "example.com/app" ||
+		doc.Packages[0].Checksums[0].ChecksumValue != sum || doc.Relationships[0].RelatedSPDXElement != "SPDXRef-Package-0" {
+		t.Fatalf("bad: %#v", doc)
+	}
+
+	b.SBOM = []string{"swid"}
+	if _, err := b.Plan([]string{"example.com/app"}, []Platform{{OS: "linux", Arch: "arm64"}}, nil); err == nil {
+		t.Fatal("expected error for unknown format")
+	}
+}
+
+func TestNewSBOMModule(t *testing.T) {
+	m := newSBOMModule(&debug.Module{
+		Path:    "github.com/foo/bar",
+		Version: "v1.0.0",
+		Sum:     "h1:aaaa",
+		Replace: &debug.Module{
+			Path:    "github.com/Baz/bar",
+			Version: "v1.0.1+incompatible",
+			Sum:     "h1:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=",
+		},
+	})
+
+	expected := sbomModule{
+		Path:    "github.com/Baz/bar",
+		Version: "v1.0.1+incompatible",
+		Sum:     "h1:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=",
+	}
+	if m != expected {
+		t.Fatalf("bad: %#v", m)
+	}
+	if m.purl() != "pkg:golang/github.com/Baz/bar@v1.0.1+incompatible?type=module" {
+		t.Fatalf("bad: %s", m.purl())
+	}
+
+	// The main module of a binary built from a checkout has no version.
+	m = newSBOMModule(&debug.Module{Path: "example.com/app", Version: "(devel)"})
+	if m.purl() != "pkg:golang/example.com/app?type=module" || m.Sum != "" {
+		t.Fatalf("bad: %#v", m)
+	}
+}
+
+func TestNewSBOM_sum(t *testing.T) {
+	info := &sbomInfo{
+		Name:   "app",
+		SHA256: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		Main:   sbomModule{Path: "example.com/app"},
+		Deps:   []sbomModule{{Path: "github.com/foo/bar", Version: "v1.0.0", Sum: "h1:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="}},
+	}
+
+	// The h1: hash of a module isn't a SHA-256 checksum of it.
+	dep := newCycloneDX(info).Components[0]
+	if len(dep.Hashes) != 0 || len(dep.Properties) != 1 || dep.Properties[0].Value != info.Deps[0].Sum {
+		t.Fatalf("bad: %#v", dep)
+	}
+
+	doc := newSPDX(info)
+	if len(doc.Packages[1].Checksums) != 0 || doc.Packages[0].Checksums[0].ChecksumValue != info.SHA256 {
+		t.Fatalf("bad: %#v", doc.Packages)
+	}
+}
+
+func readJSON(t *testing.T, path string, v any) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
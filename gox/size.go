@@ -0,0 +1,74 @@
+package gox
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits are the units accepted by ParseSize, longest suffix first so
+// that "MiB" isn't mistaken for "B".
+var sizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"KIB", 1 << 10},
+	{"MIB", 1 << 20},
+	{"GIB", 1 << 30},
+	{"KB", 1000},
+	{"MB", 1000 * 1000},
+	{"GB", 1000 * 1000 * 1000},
+	{"K", 1 << 10},
+	{"M", 1 << 20},
+	{"G", 1 << 30},
+	{"B", 1},
+}
+
+// ParseSize parses a size such as "8MiB", "500KB" or "1048576", where the
+// binary units are powers of 1024 and the decimal units powers of 1000.
+// The short forms "K", "M" and "G" are binary.
+func ParseSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	unit := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(value, u.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, u.suffix))
+			unit = u.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	return int64(n * float64(unit)), nil
+}
+
+// FormatSize formats a size in bytes using binary units, e.g. "1.5 MiB".
+func FormatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// SizeError is the error of a build whose binary is over its size budget.
+type SizeError struct {
+	Size    int64
+	MaxSize int64
+}
+
+func (e *SizeError) Error() string {
+	return fmt.Sprintf("binary is %s, %s over the size budget of %s",
+		FormatSize(e.Size), FormatSize(e.Size-e.MaxSize), FormatSize(e.MaxSize))
+}
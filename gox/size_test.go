@@ -0,0 +1,54 @@
+package gox
+
+import (
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	cases := []struct {
+		Input    string
+		Expected int64
+		Err      bool
+	}{
+		{"1048576", 1 << 20, false},
+		{"8MiB", 8 << 20, false},
+		{"8 mib", 8 << 20, false},
+		{"1.5K", 1536, false},
+		{"500KB", 500000, false},
+		{"2GB", 2000000000, false},
+		{"10B", 10, false},
+		{"", 0, true},
+		{"big", 0, true},
+		{"-1MB", 0, true},
+	}
+
+	for _, tc := range cases {
+		actual, err := ParseSize(tc.Input)
+		if (err != nil) != tc.Err {
+			t.Fatalf("bad: %q: %v", tc.Input, err)
+		}
+		if actual != tc.Expected {
+			t.Fatalf("bad: %q: %d", tc.Input, actual)
+		}
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	cases := []struct {
+		Size     int64
+		Expected string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{5 * 1024 * 1024, "5.0 MiB"},
+		{3 << 30, "3.0 GiB"},
+	}
+
+	for _, tc := range cases {
+		if actual := FormatSize(tc.Size); actual != tc.Expected {
+			t.Fatalf("bad: %d: %s", tc.Size, actual)
+		}
+	}
+}
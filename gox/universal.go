@@ -0,0 +1,275 @@
+package gox
+
+import (
+	"context"
+	"debug/macho"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// UniversalArch is the architecture of universal darwin binaries in the
+// output template.
+const UniversalArch = "universal"
+
+// universalArchs are the architectures merged into a universal binary.
+var universalArchs = []string{"amd64", "arm64"}
+
+// CreateUniversal merges thin Mach-O binaries, one for each architecture,
+// into a universal binary at path, like "lipo -create".
+func CreateUniversal(path string, binaries ...string) error {
+	type slice struct {
+		cpu    macho.Cpu
+		subCpu uint32
+		data   []byte
+		align  uint32
+	}
+
+	slices := make([]slice, 0, len(binaries))
+	for _, binary := range binaries {
+		data, err := os.ReadFile(binary)
+		if err != nil {
+			return err
+		}
+
+		f, err := macho.Open(binary)
+		if err != nil {
+			return fmt.Errorf("%s: %w", binary, err)
+		}
+		f.Close()
+
+		for _, s := range slices {
+			if s.cpu == f.Cpu {
+				return fmt.Errorf("%s: more than one binary for %s", binary, f.Cpu)
+			}
+		}
+
+		// Slices are aligned to the page size of the architecture, as a
+		// power of two.
+		align := uint32(12)
+		if f.Cpu == macho.CpuArm64 {
+			align = 14
+		}
+
+		slices = append(slices, slice{cpu: f.Cpu, subCpu: f.SubCpu, data: data, align: align})
+	}
+
+	// The header is followed by an entry for each slice, then by the
+	// slices themselves.
+	offset := uint32(8 + 20*len(slices))
+	out := binary.BigEndian.AppendUint32(nil, macho.MagicFat)
+	out = binary.BigEndian.AppendUint32(out, uint32(len(slices)))
+	offsets := make([]uint32, len(slices))
+	for i, s := range slices {
+		offset = (offset + 1<<s.align - 1) &^ (1<<s.align - 1)
+		if uint64(offset)+uint64(len(s.data)) > 1<<32-1 {
+			return fmt.Errorf("universal binary is too large")
+		}
+		offsets[i] = offset
+
+		for _, v := range []uint32{uint32(s.cpu), s.subCpu, offset, uint32(len(s.data)), s.align} {
+			out = binary.BigEndian.AppendUint32(out, v)
+		}
+		offset += uint32(len(s.data))
+	}
+
+	for i, s := range slices {
+		out = append(out, make([]byte, int(offsets[i])-len(out))...)
+		out = append(out, s.data...)
+	}
+
+	return os.WriteFile(path, out, 0755)
+}
+
+// buildUniversal merges the darwin binaries of each package into a
+// universal binary, once every job is built, and returns a result for
+// each. The packages that weren't built for every architecture in
+// universalArchs are left alone.
+func (b *Builder) buildUniversal(ctx context.Context, results []*Result, reporter Reporter) []*Result {
+	thin := make(map[string]map[string]*Result)
+	packages := make([]string, 0)
+	for _, r := range results {
+		if r.Job.Platform.OS != "darwin" || r.Job.Platform.Variant != "" {
+			continue
+		}
+
+		if _, ok := thin[r.Job.Package]; !ok {
+			thin[r.Job.Package] = make(map[string]*Result)
+			packages = append(packages, r.Job.Package)
+		}
+		thin[r.Job.Package][r.Job.Platform.Arch] = r
+	}
+
+	universal := make([]*Result, 0)
+	for _, pkg := range packages {
+		merged := make([]*Result, 0, len(universalArchs))
+		for _, arch := range universalArchs {
+			if r, ok := thin[pkg][arch]; ok {
+				merged = append(merged, r)
+			}
+		}
+		if len(merged) != len(universalArchs) {
+			continue
+		}
+
+		job := universalJob(merged[len(merged)-1].Job)
+		result := &Result{Job: job}
+		universal = append(universal, result)
+
+		for _, r := range merged {
+			if r.Err != nil || r.Skip != "" {
+				result.Skip = fmt.Sprintf("darwin/%s wasn't built", r.Job.Platform.Arch)
+			}
+		}
+		if ctx.Err() != nil {
+			result.Skip = "canceled"
+		}
+		if result.Skip != "" {
+			reporter.BuildSkip(job.Package, job.Platform, result.Skip)
+			continue
+		}
+
+		reporter.BuildStart(job.Package, job.Platform)
+		result.Err = b.mergeUniversal(ctx, result, merged)
+		reporter.BuildFinish(job.Package, job.Platform, result.Elapsed, result.Err)
+	}
+
+	return universal
+}
+
+// sameFlags returns an error if the thin binaries of merged weren't built
+// with the same flags, since a universal binary is recorded as built with
+// a single set of them. Whether cgo is enabled may differ, as by default
+// it only is for the arch that gox runs on.
+func sameFlags(merged []*Result) error {
+	flags := func(r *Result) ([]string, error) {
+		cmd, err := GoBuildCommand(r.Job.Opts)
+		if err != nil {
+			return nil, err
+		}
+
+		opts := r.Job.Opts
+		return []string{
+			"ldflags", cmd.Ldflags,
+			"gcflags", cmd.Gcflags,
+			"asmflags", cmd.Asmflags,
+			"tags", cmd.Tags,
+			"buildmode", opts.Buildmode,
+			"race", strconv.FormatBool(opts.Race),
+			"trimpath", strconv.FormatBool(opts.TrimPath),
+		}, nil
+	}
+
+	first, err := flags(merged[0])
+	if err != nil {
+		return err
+	}
+	for _, r := range merged[1:] {
+		other, err := flags(r)
+		if err != nil {
+			return err
+		}
+
+		for i := 0; i < len(first); i += 2 {
+			if first[i+1] != other[i+1] {
+				return fmt.Errorf("%s and %s were built with different %s, %q and %q, so they can't be merged into a universal binary",
+					merged[0].Job.Platform.String(), r.Job.Platform.String(), first[i], first[i+1], other[i+1])
+			}
+		}
+	}
+
+	return nil
+}
+
+// universalJob returns the job of the universal binary that the arm64 job
+// is merged into. It is built like the arm64 one, but for the universal
+// architecture.
+func universalJob(arm64 *Job) *Job {
+	opts := *arm64.Opts
+	opts.Platform = Platform{OS: "darwin", Arch: UniversalArch}
+	opts.Log = nil
+	return &Job{Package: arm64.Package, Platform: opts.Platform, Opts: &opts, Dir: arm64.Dir}
+}
+
+// mergeUniversal creates the universal binary of the result from the thin
+// binaries of merged, which must have been built with the same flags. It
+// is checked against the size budget like any other binary, with the
+// options of the arm64 one, and each slice is verified with the options of
+// its thin binary.
+func (b *Builder) mergeUniversal(ctx context.Context, result *Result, merged []*Result) error {
+	job := result.Job
+	output, err := OutputPath(job.Opts)
+	if err != nil {
+		return err
+	}
+
+	if err := sameFlags(merged); err != nil {
+		return err
+	}
+
+	binaries := make([]string, len(merged))
+	for i, r := range merged {
+		binaries[i] = r.Artifacts[0].Path
+		if binaries[i] == output {
+			return fmt.Errorf("output is the same as for %s, use {{.Arch}} in the output", r.Job.Platform.String())
+		}
+	}
+	start := time.Now()
+	err = CreateUniversal(output, binaries...)
+	result.Elapsed = time.Since(start)
+	if err != nil {
+		return err
+	}
+
+	if !b.SkipVerify {
+		thin := make([]*CompileOpts, len(merged))
+		for i, r := range merged {
+			thin[i] = r.Job.Opts
+		}
+		if err := VerifyUniversal(output, thin); err != nil {
+			return err
+		}
+	}
+
+	binary := NewArtifact("binary", job.Package, output, job.Opts, result.Elapsed, b.GoVersion)
+	result.Artifacts = []Artifact{binary}
+
+	if job.Opts.MaxSize > 0 {
+		info, err := os.Stat(output)
+		if err != nil {
+			return err
+		}
+
+		if info.Size() > job.Opts.MaxSize {
+			return &SizeError{Size: info.Size(), MaxSize: job.Opts.MaxSize}
+		}
+	}
+
+	sboms, err := b.writeSBOMs(job, &binary)
+	result.Artifacts = append([]Artifact{binary}, sboms...)
+	if err != nil {
+		return err
+	}
+
+	built, err := b.postBuild(ctx, job, binary)
+	result.Artifacts = append(result.Artifacts, built...)
+	if err != nil {
+		return err
+	}
+
+	// The thin binaries are only removed once the universal binary is
+	// done, along with everything made from them, so that no result has
+	// artifacts that are gone.
+	if b.UniversalReplace {
+		for _, r := range merged {
+			for _, a := range r.Artifacts {
+				os.Remove(a.Path)
+			}
+			r.Artifacts = nil
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,175 @@
+package gox
+
+import (
+	"context"
+	"debug/macho"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuilder_universal(t *testing.T) {
+	td := testModule(t, map[string]string{})
+	b := &Builder{Parallel: 2, Universal: true, UniversalReplace: true}
+	platforms := []Platform{
+		{OS: "darwin", Arch: "amd64"},
+		{OS: "darwin", Arch: "arm64"},
+		{OS: "linux", Arch: "amd64"},
+	}
+	jobs, err := b.Plan([]string{"example.com/app"}, platforms, func(pkg string, platform Platform) (*CompileOpts, error) {
+		return &CompileOpts{
+			PackagePath: pkg,
+			Platform:    platform,
+			OutputTpl:   filepath.Join(td, DefaultOutputTpl),
+			GoCmd:       "go",
+		}, nil
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	results := b.Build(context.Background(), jobs)
+	if len(results) != 4 {
+		t.Fatalf("bad: %d results", len(results))
+	}
+	for _, r := range results {
+		if r.Err != nil || r.Skip != "" {
+			t.Fatalf("%s: %v %s", r.Job.Platform.String(), r.Err, r.Skip)
+		}
+	}
+
+	universal := results[3]
+	if universal.Job.Platform.String() != "darwin/universal" || len(universal.Artifacts) != 1 {
+		t.Fatalf("bad: %#v", universal)
+	}
+
+	path := universal.Artifacts[0].Path
+	if path != filepath.Join(td, "app_darwin_universal") {
+		t.Fatalf("bad: %s", path)
+	}
+
+	f, err := macho.OpenFat(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer f.Close()
+
+	if len(f.Arches) != 2 || f.Arches[0].Cpu != macho.CpuAmd64 || f.Arches[1].Cpu != macho.CpuArm64 {
+		t.Fatalf("bad: %#v", f.Arches)
+	}
+	if f.Arches[0].Offset%(1<<12) != 0 || f.Arches[1].Offset%(1<<14) != 0 {
+		t.Fatalf("bad: %#v", f.Arches)
+	}
+	if f.Arches[1].Symtab == nil {
+		t.Fatal("bad: no symbols in the arm64 slice")
+	}
+
+	// Each slice is verified with the options of its thin binary.
+	if err := VerifyUniversal(path, []*CompileOpts{results[0].Job.Opts, results[1].Job.Opts}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The thin binaries are replaced, but not the linux one.
+	for i, exists := range []bool{false, false, true} {
+		if _, err := os.Stat(filepath.Join(td, "app_"+platforms[i].OS+"_"+platforms[i].Arch)); (err == nil) != exists {
+			t.Fatalf("bad: %s: %v", platforms[i].String(), err)
+		}
+		if (len(results[i].Artifacts) > 0) != exists {
+			t.Fatalf("bad: %s: %#v", platforms[i].String(), results[i].Artifacts)
+		}
+	}
+}
+
+func TestBuilder_universalMaxSize(t *testing.T) {
+	td := testModule(t, map[string]string{})
+	b := &Builder{Parallel: 2, Universal: true, UniversalReplace: true}
+	platforms := []Platform{
+		{OS: "darwin", Arch: "amd64"},
+		{OS: "darwin", Arch: "arm64"},
+	}
+	jobs, err := b.Plan([]string{"example.com/app"}, platforms, func(pkg string, platform Platform) (*CompileOpts, error) {
+		return &CompileOpts{
+			PackagePath: pkg,
+			Platform:    platform,
+			OutputTpl:   filepath.Join(td, DefaultOutputTpl),
+			GoCmd:       "go",
+			MaxSize:     3 << 20,
+		}, nil
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The thin binaries fit in the budget, but not both of them at once,
+	// so they are kept.
+	results := b.Build(context.Background(), jobs)
+	var sizeErr *SizeError
+	if results[0].Err != nil || results[1].Err != nil || !errors.As(results[2].Err, &sizeErr) {
+		t.Fatalf("bad: %v %v %v", results[0].Err, results[1].Err, results[2].Err)
+	}
+	for _, r := range results[:2] {
+		if _, err := os.Stat(r.Artifacts[0].Path); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	// A universal binary without the arm64 slice isn't for the platform.
+	path := filepath.Join(td, "app_darwin_universal")
+	if err := CreateUniversal(path, results[0].Artifacts[0].Path); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var mismatch *PlatformMismatchError
+	if err := VerifyBinary(path, results[2].Job.Opts); !errors.As(err, &mismatch) {
+		t.Fatalf("bad: %v", err)
+	}
+	if err := VerifyBinary(results[0].Artifacts[0].Path, results[2].Job.Opts); err == nil {
+		t.Fatal("expected error for a thin binary")
+	}
+}
+
+func TestBuilder_universalFlags(t *testing.T) {
+	td := testModule(t, map[string]string{})
+	b := &Builder{Parallel: 2, Universal: true}
+	platforms := []Platform{
+		{OS: "darwin", Arch: "amd64"},
+		{OS: "darwin", Arch: "arm64"},
+	}
+	jobs, err := b.Plan([]string{"example.com/app"}, platforms, func(pkg string, platform Platform) (*CompileOpts, error) {
+		return &CompileOpts{
+			PackagePath: pkg,
+			Platform:    platform,
+			OutputTpl:   filepath.Join(td, DefaultOutputTpl),
+			GoCmd:       "go",
+			Ldflags:     "-X main.arch={{.Arch}}",
+		}, nil
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The thin binaries are built, but not merged.
+	results := b.Build(context.Background(), jobs)
+	if results[0].Err != nil || results[1].Err != nil {
+		t.Fatalf("bad: %v %v", results[0].Err, results[1].Err)
+	}
+	if err := results[2].Err; err == nil || !strings.Contains(err.Error(), "different ldflags") {
+		t.Fatalf("bad: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(td, "app_darwin_universal")); err == nil {
+		t.Fatal("bad: universal binary was created")
+	}
+}
+
+func TestCreateUniversal_notMacho(t *testing.T) {
+	td := t.TempDir()
+	path := filepath.Join(td, "foo")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := CreateUniversal(filepath.Join(td, "out"), path); err == nil {
+		t.Fatal("expected error")
+	}
+}
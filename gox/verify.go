@@ -0,0 +1,355 @@
+package gox
+
+import (
+	"bytes"
+	"debug/buildinfo"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"debug/plan9obj"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// PlatformMismatchError is the error of a build whose binary isn't for the
+// platform it was built for, such as when the environment overrides GOARCH.
+type PlatformMismatchError struct {
+	Platform Platform
+	Reason   string
+}
+
+func (e *PlatformMismatchError) Error() string {
+	return fmt.Sprintf("binary isn't for %s: %s", e.Platform.String(), e.Reason)
+}
+
+// elfArchs are the machine, class and byte order of ELF files by arch.
+var elfArchs = []struct {
+	arch    string
+	machine elf.Machine
+	class   elf.Class
+	big     bool
+}{
+	{"386", elf.EM_386, elf.ELFCLASS32, false},
+	{"amd64", elf.EM_X86_64, elf.ELFCLASS64, false},
+	{"arm", elf.EM_ARM, elf.ELFCLASS32, false},
+	{"arm64", elf.EM_AARCH64, elf.ELFCLASS64, false},
+	{"loong64", elf.EM_LOONGARCH, elf.ELFCLASS64, false},
+	{"mips", elf.EM_MIPS, elf.ELFCLASS32, true},
+	{"mipsle", elf.EM_MIPS, elf.ELFCLASS32, false},
+	{"mips64", elf.EM_MIPS, elf.ELFCLASS64, true},
+	{"mips64le", elf.EM_MIPS, elf.ELFCLASS64, false},
+	{"ppc64", elf.EM_PPC64, elf.ELFCLASS64, true},
+	{"ppc64le", elf.EM_PPC64, elf.ELFCLASS64, false},
+	{"riscv64", elf.EM_RISCV, elf.ELFCLASS64, false},
+	{"s390x", elf.EM_S390, elf.ELFCLASS64, true},
+	{"sparc64", elf.EM_SPARCV9, elf.ELFCLASS64, true},
+}
+
+// peArchs are the machine and bitness of PE files by arch.
+var peArchs = []struct {
+	arch    string
+	machine uint16
+	is64    bool
+}{
+	{"386", pe.IMAGE_FILE_MACHINE_I386, false},
+	{"amd64", pe.IMAGE_FILE_MACHINE_AMD64, true},
+	{"arm", pe.IMAGE_FILE_MACHINE_ARMNT, false},
+	{"arm64", pe.IMAGE_FILE_MACHINE_ARM64, true},
+}
+
+// machoArchs are the CPU and bitness of Mach-O files by arch.
+var machoArchs = []struct {
+	arch  string
+	cpu   macho.Cpu
+	magic uint32
+}{
+	{"amd64", macho.CpuAmd64, macho.Magic64},
+	{"arm64", macho.CpuArm64, macho.Magic64},
+}
+
+// plan9Archs are the magic numbers of Plan 9 a.out files by arch.
+var plan9Archs = map[uint32]string{
+	plan9obj.Magic386:   "386",
+	plan9obj.MagicAMD64: "amd64",
+	plan9obj.MagicARM:   "arm",
+}
+
+// binaryFormat returns the file format that binaries for the OS have.
+func binaryFormat(goos string) string {
+	switch goos {
+	case "windows":
+		return "PE"
+	case "darwin", "ios":
+		return "Mach-O"
+	case "plan9":
+		return "Plan 9 a.out"
+	case "aix":
+		return "XCOFF"
+	case "js", "wasip1":
+		return "WebAssembly"
+	default:
+		return "ELF"
+	}
+}
+
+// errNotBinary is returned for files that aren't binaries.
+var errNotBinary = errors.New("not a binary")
+
+// readBinaryArch returns the file format of the binary in r and the arch
+// that its machine type and bitness are for, or a description of them if
+// they aren't for any arch.
+func readBinaryArch(r io.ReaderAt) (string, string, error) {
+	magic := make([]byte, 8)
+	if _, err := r.ReadAt(magic, 0); err != nil {
+		return "", "", errNotBinary
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, []byte(elf.ELFMAG)):
+		ef, err := elf.NewFile(r)
+		if err != nil {
+			return "", "", err
+		}
+		defer ef.Close()
+
+		big := ef.ByteOrder == binary.BigEndian
+		for _, a := range elfArchs {
+			if ef.Machine == a.machine && ef.Class == a.class && big == a.big {
+				return "ELF", a.arch, nil
+			}
+		}
+		return "ELF", fmt.Sprintf("%s %s %s", ef.Machine, ef.Class, ef.Data), nil
+
+	case bytes.HasPrefix(magic, []byte("MZ")):
+		pf, err := pe.NewFile(r)
+		if err != nil {
+			return "", "", err
+		}
+		defer pf.Close()
+
+		_, is64 := pf.OptionalHeader.(*pe.OptionalHeader64)
+		for _, a := range peArchs {
+			if pf.Machine == a.machine && is64 == a.is64 {
+				return "PE", a.arch, nil
+			}
+		}
+		return "PE", fmt.Sprintf("machine %#x", pf.Machine), nil
+
+	case bytes.HasPrefix(magic, []byte("\x00asm")):
+		return "WebAssembly", "wasm", nil
+
+	case bytes.HasPrefix(magic, []byte{0x01, 0xf7}):
+		return "XCOFF", "ppc64", nil
+	}
+
+	if mf, err := macho.NewFile(r); err == nil {
+		defer mf.Close()
+
+		for _, a := range machoArchs {
+			if mf.Cpu == a.cpu && mf.Magic == a.magic {
+				return "Mach-O", a.arch, nil
+			}
+		}
+		return "Mach-O", mf.Cpu.String(), nil
+	}
+
+	if arch, ok := plan9Archs[binary.BigEndian.Uint32(magic)]; ok {
+		return "Plan 9 a.out", arch, nil
+	}
+
+	return "", "", errNotBinary
+}
+
+// VerifyBinary returns a *PlatformMismatchError if the binary at path, as
+// built with opts, isn't for the platform it was built for. Its file
+// format, machine type and bitness must be those of the platform, and its
+// build information must have the GOOS, GOARCH, variant, CGO_ENABLED and
+// tags of the build, where it can be read. Archives built with
+// -buildmode=c-archive aren't checked. A universal binary must have a
+// slice for each of the architectures it merges, which is checked like a
+// binary of its own built with opts for that architecture, see
+// VerifyUniversal to check them with the options of each thin binary.
+func VerifyBinary(path string, opts *CompileOpts) error {
+	if opts.Platform.Arch != UniversalArch {
+		return verifyFile(path, opts, func(r io.ReaderAt) error {
+			return verifyBinary(r, opts)
+		})
+	}
+
+	thin := make([]*CompileOpts, len(universalArchs))
+	for i, arch := range universalArchs {
+		slice := *opts
+		slice.Platform.Arch = arch
+		thin[i] = &slice
+	}
+
+	return VerifyUniversal(path, thin)
+}
+
+// VerifyUniversal is VerifyBinary for the universal binary at path, whose
+// slices are checked with the options of the thin binaries they were made
+// from, one for each of the architectures it merges.
+func VerifyUniversal(path string, thin []*CompileOpts) error {
+	opts := *thin[0]
+	opts.Platform.Arch = UniversalArch
+	return verifyFile(path, &opts, func(r io.ReaderAt) error {
+		return verifyUniversal(r, opts.Platform, thin)
+	})
+}
+
+// verifyFile runs verify on the binary at path, built with opts.
+func verifyFile(path string, opts *CompileOpts, verify func(r io.ReaderAt) error) error {
+	if opts.Buildmode == "c-archive" {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = verify(f)
+	var mismatch *PlatformMismatchError
+	if err != nil && !errors.As(err, &mismatch) {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	return err
+}
+
+// verifyUniversal verifies each slice of the universal binary in r with
+// the options of the thin binary for its arch.
+func verifyUniversal(r io.ReaderAt, platform Platform, thin []*CompileOpts) error {
+	ff, err := macho.NewFatFile(r)
+	if err != nil {
+		return err
+	}
+	defer ff.Close()
+
+	if len(ff.Arches) != len(universalArchs) {
+		return &PlatformMismatchError{Platform: platform, Reason: fmt.Sprintf("it has %d slices", len(ff.Arches))}
+	}
+
+	// Each slice is found by its CPU, and must then be a binary for the
+	// arch of that CPU.
+	for _, arch := range universalArchs {
+		var slice *macho.FatArch
+		for _, a := range machoArchs {
+			for i := range ff.Arches {
+				if a.arch == arch && ff.Arches[i].Cpu == a.cpu {
+					slice = &ff.Arches[i]
+				}
+			}
+		}
+		if slice == nil {
+			return &PlatformMismatchError{Platform: platform, Reason: "it has no slice for " + arch}
+		}
+
+		var opts *CompileOpts
+		for _, o := range thin {
+			if o.Platform.Arch == arch {
+				opts = o
+			}
+		}
+		if opts == nil {
+			return fmt.Errorf("no options for the %s slice", arch)
+		}
+
+		if err := verifyBinary(io.NewSectionReader(r, int64(slice.Offset), int64(slice.Size)), opts); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// verifyBinary verifies the binary in r, see VerifyBinary.
+func verifyBinary(r io.ReaderAt, opts *CompileOpts) error {
+	cmd, err := GoBuildCommand(opts)
+	if err != nil {
+		return err
+	}
+
+	platform := opts.Platform
+	mismatch := func(format string, args ...any) error {
+		return &PlatformMismatchError{Platform: platform, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	format, arch, err := readBinaryArch(r)
+	if err != nil {
+		return err
+	}
+	if format != binaryFormat(platform.OS) || arch != platform.Arch {
+		return mismatch("it is %s for %s", format, arch)
+	}
+
+	// The build information can't be read from every format, so those
+	// binaries are only checked as far as the file goes.
+	info, err := buildinfo.Read(r)
+	if err != nil {
+		if format == "WebAssembly" || format == "Plan 9 a.out" {
+			return nil
+		}
+
+		return mismatch("no build information: %s", err)
+	}
+
+	settings := make(map[string]string)
+	for _, s := range info.Settings {
+		settings[s.Key] = s.Value
+	}
+
+	// The last value of CGO_ENABLED is the one in effect, since the extra
+	// environment variables can override it.
+	expected := map[string]string{
+		"GOOS":   platform.OS,
+		"GOARCH": platform.Arch,
+	}
+	for _, kv := range cmd.Env {
+		if k, v, ok := strings.Cut(kv, "="); ok && k == "CGO_ENABLED" {
+			expected[k] = v
+		}
+	}
+	if platform.Variant != "" {
+		expected[platform.VariantEnv()] = platform.Variant
+	}
+
+	for _, k := range []string{"GOOS", "GOARCH", "CGO_ENABLED", platform.VariantEnv()} {
+		want, ok := expected[k]
+		if !ok {
+			continue
+		}
+
+		// Settings that aren't recorded aren't checked, other than the
+		// platform itself.
+		got, ok := settings[k]
+		if !ok && k != "GOOS" && k != "GOARCH" {
+			continue
+		}
+		if got != want {
+			return mismatch("it was built with %s=%s", k, got)
+		}
+	}
+
+	if got, want := splitTags(settings["-tags"]), splitTags(cmd.Tags); got != want {
+		return mismatch("it was built with tags %q, not %q", got, want)
+	}
+
+	return nil
+}
+
+// splitTags returns the build tags of a -tags value, which are separated
+// by commas or spaces, sorted and separated by commas.
+func splitTags(tags string) string {
+	fields := strings.FieldsFunc(tags, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+	sort.Strings(fields)
+	return strings.Join(fields, ",")
+}
@@ -0,0 +1,81 @@
+package gox
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyBinary(t *testing.T) {
+	td := testModule(t, map[string]string{})
+	opts := &CompileOpts{
+		PackagePath: "example.com/app",
+		Platform:    Platform{OS: "linux", Arch: "arm", Variant: "6"},
+		OutputTpl:   filepath.Join(td, DefaultOutputTpl),
+		GoCmd:       "go",
+		Tags:        "foo {{.Arch}}",
+	}
+	output, err := GoCrossCompile(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := VerifyBinary(output, opts); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cases := []func(opts *CompileOpts){
+		func(opts *CompileOpts) { opts.Platform = Platform{OS: "linux", Arch: "arm64"} },
+		func(opts *CompileOpts) { opts.Platform = Platform{OS: "freebsd", Arch: "arm", Variant: "6"} },
+		func(opts *CompileOpts) { opts.Platform.Variant = "7" },
+		func(opts *CompileOpts) { opts.Tags = "foo" },
+		func(opts *CompileOpts) { opts.Env = []string{"CGO_ENABLED=1"} },
+	}
+	for i, tc := range cases {
+		other := *opts
+		tc(&other)
+
+		var mismatch *PlatformMismatchError
+		if err := VerifyBinary(output, &other); !errors.As(err, &mismatch) {
+			t.Fatalf("%d: bad: %v", i, err)
+		}
+	}
+
+	script := filepath.Join(td, "script")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := VerifyBinary(script, opts); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestBuilder_verify(t *testing.T) {
+	td := testModule(t, map[string]string{})
+	newOpts := func(pkg string, platform Platform) (*CompileOpts, error) {
+		return &CompileOpts{
+			PackagePath: pkg,
+			Platform:    platform,
+			OutputTpl:   filepath.Join(td, DefaultOutputTpl),
+			GoCmd:       "go",
+			Env:         []string{"GOARCH=amd64"},
+		}, nil
+	}
+
+	// The environment overrides the arch of the arm64 build.
+	for _, skip := range []bool{false, true} {
+		b := &Builder{Parallel: 1, SkipVerify: skip}
+		jobs, err := b.Plan([]string{"example.com/app"}, []Platform{{OS: "linux", Arch: "arm64"}}, newOpts)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		results := b.Build(context.Background(), jobs)
+		var mismatch *PlatformMismatchError
+		if errors.As(results[0].Err, &mismatch) == skip {
+			t.Fatalf("bad: %v", results[0].Err)
+		}
+	}
+}
@@ -0,0 +1,541 @@
+package gox
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode/utf16"
+)
+
+// WindowsResources are the resources embedded into Windows binaries: the
+// version information shown in the file properties, an icon and an
+// application manifest.
+type WindowsResources struct {
+	// Icon and Manifest are the paths to an .ico file and to an
+	// application manifest, or empty for none.
+	Icon     string
+	Manifest string
+
+	// VersionInfo are the strings of the version information, such as
+	// "CompanyName" or "FileDescription", by name. They are templates
+	// executed with the OutputTemplateData of the build. FileVersion and
+	// ProductVersion default to {{.Version}}, and their leading numbers,
+	// e.g. 1.2.3 in "v1.2.3-4-gabcdef0" followed by 4 commits since the
+	// tag, are also the numeric versions.
+	VersionInfo map[string]string
+}
+
+// windowsResourceMachines are the COFF machine types and ADDR32NB
+// relocation types by architecture. The Go linker only loads resources
+// for these.
+var windowsResourceMachines = map[string]struct {
+	machine uint16
+	reloc   uint16
+}{
+	"386":   {0x14c, 0x7},
+	"amd64": {0x8664, 0x3},
+	"arm64": {0xaa64, 0x2},
+}
+
+// WindowsResourcesSupported returns true if resources can be embedded into
+// Windows binaries for the architecture.
+func WindowsResourcesSupported(arch string) bool {
+	_, ok := windowsResourceMachines[arch]
+	return ok
+}
+
+// Validate returns an error if the icon or the manifest can't be read or
+// if the version information isn't valid.
+func (r *WindowsResources) Validate() error {
+	if r.Icon != "" {
+		data, err := os.ReadFile(r.Icon)
+		if err != nil {
+			return err
+		}
+		if _, err := parseIcon(data); err != nil {
+			return fmt.Errorf("%s: %w", r.Icon, err)
+		}
+	}
+
+	if r.Manifest != "" {
+		if _, err := os.ReadFile(r.Manifest); err != nil {
+			return err
+		}
+	}
+
+	for name, value := range r.VersionInfo {
+		if name == "" {
+			return fmt.Errorf("empty version info name")
+		}
+		if _, err := template.New(name).Parse(value); err != nil {
+			return fmt.Errorf("version info %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// WriteSyso writes a COFF object file with the resources to path, for the
+// Go linker to embed into Windows binaries for arch. The version strings
+// are executed with data.
+func WriteSyso(path string, arch string, r *WindowsResources, data *OutputTemplateData) error {
+	machine, ok := windowsResourceMachines[arch]
+	if !ok {
+		return fmt.Errorf("windows resources aren't supported on %s", arch)
+	}
+
+	resources := make([]resource, 0)
+
+	versionInfo, err := r.versionInfo(data)
+	if err != nil {
+		return err
+	}
+	resources = append(resources, resource{typ: rtVersion, id: 1, data: versionInfo})
+
+	if r.Icon != "" {
+		icon, err := os.ReadFile(r.Icon)
+		if err != nil {
+			return err
+		}
+
+		images, err := parseIcon(icon)
+		if err != nil {
+			return fmt.Errorf("%s: %w", r.Icon, err)
+		}
+
+		// The group refers to each image by its ID.
+		group := binary.LittleEndian.AppendUint16(nil, 0)
+		group = binary.LittleEndian.AppendUint16(group, 1)
+		group = binary.LittleEndian.AppendUint16(group, uint16(len(images)))
+		for i, img := range images {
+			group = append(group, img.entry[:12]...)
+			group = binary.LittleEndian.AppendUint16(group, uint16(i+1))
+			resources = append(resources, resource{typ: rtIcon, id: uint16(i + 1), data: img.data})
+		}
+		resources = append(resources, resource{typ: rtGroupIcon, id: 1, data: group})
+	}
+
+	if r.Manifest != "" {
+		manifest, err := os.ReadFile(r.Manifest)
+		if err != nil {
+			return err
+		}
+		resources = append(resources, resource{typ: rtManifest, id: 1, data: manifest})
+	}
+
+	section, relocs := resourceSection(resources)
+	return os.WriteFile(path, coffObject(machine.machine, machine.reloc, section, relocs), 0644)
+}
+
+// The types of the resources.
+const (
+	rtIcon      = 3
+	rtGroupIcon = 14
+	rtVersion   = 16
+	rtManifest  = 24
+)
+
+// resourceLanguage is the language of every resource, US English.
+const resourceLanguage = 0x0409
+
+// resource is a single resource of a type and an ID.
+type resource struct {
+	typ  uint16
+	id   uint16
+	data []byte
+}
+
+// iconImage is an image in an .ico file. entry is its 16-byte directory
+// entry, whose first 12 bytes are the same in a group icon resource.
+type iconImage struct {
+	entry []byte
+	data  []byte
+}
+
+// parseIcon returns the images of an .ico file.
+func parseIcon(data []byte) ([]iconImage, error) {
+	if len(data) < 6 || binary.LittleEndian.Uint16(data) != 0 || binary.LittleEndian.Uint16(data[2:]) != 1 {
+		return nil, fmt.Errorf("not an icon file")
+	}
+
+	n := int(binary.LittleEndian.Uint16(data[4:]))
+	if n == 0 || len(data) < 6+n*16 {
+		return nil, fmt.Errorf("invalid icon file")
+	}
+
+	images := make([]iconImage, 0, n)
+	for i := 0; i < n; i++ {
+		entry := data[6+i*16 : 6+(i+1)*16]
+		size := int64(binary.LittleEndian.Uint32(entry[8:]))
+		offset := int64(binary.LittleEndian.Uint32(entry[12:]))
+		if offset+size > int64(len(data)) {
+			return nil, fmt.Errorf("invalid icon file")
+		}
+
+		images = append(images, iconImage{entry: entry, data: data[offset : offset+size]})
+	}
+
+	return images, nil
+}
+
+// versionNumber matches the numbers at the start of a version, followed by
+// the number of commits since the tag as in "git describe".
+var versionNumber = regexp.MustCompile(`^v?(\d+)(?:\.(\d+))?(?:\.(\d+))?(?:\.(\d+)|-(\d+)-g[0-9a-f]+)?`)
+
+// fixedVersion returns the version as the two 32-bit halves of the fixed
+// version information, 0.0.0.0 if it doesn't start with a number.
+func fixedVersion(version string) (uint32, uint32) {
+	var parts [4]uint32
+	m := versionNumber.FindStringSubmatch(version)
+	if m != nil {
+		// The fourth number is either the fourth part of the version or
+		// the number of commits since the tag.
+		for i, s := range []string{m[1], m[2], m[3], m[4] + m[5]} {
+			n, _ := strconv.ParseUint(s, 10, 16)
+			parts[i] = uint32(n)
+		}
+	}
+
+	return parts[0]<<16 | parts[1], parts[2]<<16 | parts[3]
+}
+
+// versionInfo returns the VS_VERSIONINFO resource with the version
+// strings executed with data.
+func (r *WindowsResources) versionInfo(data *OutputTemplateData) ([]byte, error) {
+	strs := map[string]string{
+		"FileVersion":    "{{.Version}}",
+		"ProductVersion": "{{.Version}}",
+	}
+	for name, value := range r.VersionInfo {
+		strs[name] = value
+	}
+
+	names := make([]string, 0, len(strs))
+	for name, value := range strs {
+		value, err := executeTemplate(name, value, data)
+		if err != nil {
+			return nil, fmt.Errorf("version info %s: %w", name, err)
+		}
+
+		strs[name] = value
+		if value != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	fileMS, fileLS := fixedVersion(strs["FileVersion"])
+	productMS, productLS := fixedVersion(strs["ProductVersion"])
+
+	// VS_FIXEDFILEINFO, for an application on 32-bit Windows or later.
+	fixed := make([]byte, 0, 52)
+	for _, v := range []uint32{
+		0xfeef04bd, 0x00010000,
+		fileMS, fileLS, productMS, productLS,
+		0x3f, 0, 0x00040004, 1, 0, 0, 0,
+	} {
+		fixed = binary.LittleEndian.AppendUint32(fixed, v)
+	}
+
+	table := make([][]byte, 0, len(names))
+	for _, name := range names {
+		value := utf16z(strs[name])
+		table = append(table, versionNode(name, 1, value, uint16(len(value)/2)))
+	}
+
+	translation := binary.LittleEndian.AppendUint16(nil, resourceLanguage)
+	translation = binary.LittleEndian.AppendUint16(translation, 1200)
+
+	info := versionNode("VS_VERSION_INFO", 0, fixed, uint16(len(fixed)),
+		versionNode("StringFileInfo", 1, nil, 0,
+			versionNode(fmt.Sprintf("%04X04B0", resourceLanguage), 1, nil, 0, table...)),
+		versionNode("VarFileInfo", 1, nil, 0,
+			versionNode("Translation", 0, translation, uint16(len(translation)))))
+	if len(info) > 0xffff {
+		return nil, fmt.Errorf("version info is too large")
+	}
+
+	return info, nil
+}
+
+// versionNode returns a node of the version information: its length, the
+// length of its value, its type, the key and the value followed by the
+// children, each aligned to 32 bits.
+func versionNode(key string, typ uint16, value []byte, valueLength uint16, children ...[]byte) []byte {
+	b := make([]byte, 6, 64)
+	b = append(b, utf16z(key)...)
+	b = align(b, 4)
+	b = append(b, value...)
+	for _, child := range children {
+		b = align(b, 4)
+		b = append(b, child...)
+	}
+
+	binary.LittleEndian.PutUint16(b, uint16(len(b)))
+	binary.LittleEndian.PutUint16(b[2:], valueLength)
+	binary.LittleEndian.PutUint16(b[4:], typ)
+	return b
+}
+
+// utf16z returns s in little-endian UTF-16 with a NUL terminator.
+func utf16z(s string) []byte {
+	b := make([]byte, 0, len(s)*2+2)
+	for _, c := range utf16.Encode([]rune(s)) {
+		b = binary.LittleEndian.AppendUint16(b, c)
+	}
+	return append(b, 0, 0)
+}
+
+// align pads b with zeros to a multiple of n bytes.
+func align(b []byte, n int) []byte {
+	for len(b)%n != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// resourceSection returns the .rsrc section with the resources, and the
+// offsets of the addresses in it that have to be relocated. The section is
+// a tree of directories, by type, ID and language, whose leaves point to
+// the data.
+func resourceSection(resources []resource) ([]byte, []uint32) {
+	sort.Slice(resources, func(i, j int) bool {
+		if resources[i].typ != resources[j].typ {
+			return resources[i].typ < resources[j].typ
+		}
+		return resources[i].id < resources[j].id
+	})
+
+	types := make([]uint16, 0)
+	byType := make(map[uint16][]int)
+	for i, res := range resources {
+		if _, ok := byType[res.typ]; !ok {
+			types = append(types, res.typ)
+		}
+		byType[res.typ] = append(byType[res.typ], i)
+	}
+
+	// Lay out the root, then the directory of IDs of each type, the
+	// directory of languages of each resource, the data entries and the
+	// data itself.
+	dirSize := func(n int) uint32 { return uint32(16 + 8*n) }
+	offset := dirSize(len(types))
+	typeDirs := make(map[uint16]uint32)
+	for _, typ := range types {
+		typeDirs[typ] = offset
+		offset += dirSize(len(byType[typ]))
+	}
+	langDirs := make([]uint32, len(resources))
+	for i := range resources {
+		langDirs[i] = offset
+		offset += dirSize(1)
+	}
+	entries := make([]uint32, len(resources))
+	for i := range resources {
+		entries[i] = offset
+		offset += 16
+	}
+	data := make([]uint32, len(resources))
+	for i, res := range resources {
+		offset = (offset + 7) &^ 7
+		data[i] = offset
+		offset += uint32(len(res.data))
+	}
+
+	var b bytes.Buffer
+	le := binary.LittleEndian
+	directory := func(n int) {
+		b.Write(make([]byte, 12))
+		binary.Write(&b, le, uint16(0))
+		binary.Write(&b, le, uint16(n))
+	}
+	directoryEntry := func(id uint16, offset uint32) {
+		binary.Write(&b, le, uint32(id))
+		binary.Write(&b, le, offset|0x80000000)
+	}
+
+	directory(len(types))
+	for _, typ := range types {
+		directoryEntry(typ, typeDirs[typ])
+	}
+	for _, typ := range types {
+		directory(len(byType[typ]))
+		for _, i := range byType[typ] {
+			directoryEntry(resources[i].id, langDirs[i])
+		}
+	}
+	for i := range resources {
+		directory(1)
+		binary.Write(&b, le, uint32(resourceLanguage))
+		binary.Write(&b, le, entries[i])
+	}
+
+	// The data entries point to the data by its address in the image,
+	// which the linker fills in from the offset in the section.
+	relocs := make([]uint32, len(resources))
+	for i, res := range resources {
+		relocs[i] = uint32(b.Len())
+		binary.Write(&b, le, data[i])
+		binary.Write(&b, le, uint32(len(res.data)))
+		binary.Write(&b, le, uint64(0))
+	}
+	for i, res := range resources {
+		b.Write(make([]byte, int(data[i])-b.Len()))
+		b.Write(res.data)
+	}
+
+	return b.Bytes(), relocs
+}
+
+// coffObject returns a COFF object file with section as its only section,
+// named .rsrc, and relocations at the offsets given relative to the
+// section.
+func coffObject(machine uint16, relocType uint16, section []byte, relocs []uint32) []byte {
+	const headers = 20 + 40
+	relocOffset := headers + uint32(len(section))
+	symbolOffset := relocOffset + uint32(len(relocs))*10
+
+	var b bytes.Buffer
+	le := binary.LittleEndian
+	write := func(v any) { binary.Write(&b, le, v) }
+
+	// The file header, with a single section and two symbols: the
+	// section's and its auxiliary record.
+	write(machine)
+	write(uint16(1))
+	write(uint32(0))
+	write(symbolOffset)
+	write(uint32(2))
+	write(uint16(0))
+	write(uint16(0))
+
+	// The section header, for initialized read-only data.
+	b.WriteString(".rsrc\x00\x00\x00")
+	write(uint32(0))
+	write(uint32(0))
+	write(uint32(len(section)))
+	write(uint32(headers))
+	write(relocOffset)
+	write(uint32(0))
+	write(uint16(len(relocs)))
+	write(uint16(0))
+	write(uint32(0x40000040))
+
+	b.Write(section)
+
+	for _, offset := range relocs {
+		write(offset)
+		write(uint32(0))
+		write(relocType)
+	}
+
+	// The static symbol of the section, which the relocations are
+	// relative to, followed by its definition.
+	b.WriteString(".rsrc\x00\x00\x00")
+	write(uint32(0))
+	write(int16(1))
+	write(uint16(0))
+	write(uint8(3))
+	write(uint8(1))
+	write(uint32(len(section)))
+	write(uint16(len(relocs)))
+	write(uint16(0))
+	write(uint32(0))
+	write(uint16(0))
+	b.Write(make([]byte, 4))
+
+	// An empty string table.
+	write(uint32(4))
+
+	return b.Bytes()
+}
+
+// sysoVariantRe matches the characters of a variant that are left out of
+// the name of a .syso file.
+var sysoVariantRe = regexp.MustCompile("[^a-z0-9]")
+
+// sysoPath returns the path of the .syso file of the resources of the job,
+// in the directory of its package. The platform at the end of the name
+// means only the builds for it link it, and the variant before it that
+// the builds of the other variants of the platform have their own.
+func sysoPath(job *Job) string {
+	name := "zz_gox_windows_" + job.Platform.Arch + ".syso"
+	if v := sysoVariantRe.ReplaceAllString(strings.ToLower(job.Platform.Variant), ""); v != "" {
+		name = "zz_gox_" + v + "_windows_" + job.Platform.Arch + ".syso"
+	}
+
+	return filepath.Join(job.Dir, name)
+}
+
+// embedWindowsResources writes the .syso file with the resources into the
+// directory of the package of the job, so that go build links it in. The
+// others are the .syso files of the other builds of the package, which
+// may be written at the same time, so they are hidden from the build with
+// an overlay, see CompileOpts.Overlay. It returns a function that removes
+// the files again.
+func embedWindowsResources(job *Job, r *WindowsResources, others []string) (func(), error) {
+	path := sysoPath(job)
+	if _, err := os.Lstat(path); err == nil {
+		return nil, fmt.Errorf("%s already exists", path)
+	}
+
+	data := NewOutputTemplateData(job.Opts)
+	if err := WriteSyso(path, job.Platform.Arch, r, &data); err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+
+	overlay := struct {
+		Replace map[string]string
+	}{Replace: make(map[string]string)}
+	for _, other := range others {
+		if other != path {
+			overlay.Replace[other] = ""
+		}
+	}
+	if len(overlay.Replace) == 0 {
+		return func() { os.Remove(path) }, nil
+	}
+
+	f, err := os.CreateTemp("", "gox-overlay-*.json")
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	err = json.NewEncoder(f).Encode(&overlay)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		os.Remove(f.Name())
+		return nil, err
+	}
+	job.Opts.Overlay = f.Name()
+
+	return func() {
+		os.Remove(path)
+		os.Remove(f.Name())
+	}, nil
+}
+
+// sysoPaths returns the paths of the .syso files of the jobs that have
+// Windows resources, by the directory of their package.
+func sysoPaths(jobs []*Job) map[string][]string {
+	paths := make(map[string][]string)
+	for _, job := range jobs {
+		if job.Platform.OS == "windows" && job.Skip == "" {
+			paths[job.Dir] = append(paths[job.Dir], sysoPath(job))
+		}
+	}
+
+	return paths
+}
@@ -0,0 +1,285 @@
+package gox
+
+import (
+	"bytes"
+	"context"
+	"debug/pe"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+)
+
+// testIcon returns an .ico file with a single 16x16 image.
+func testIcon() []byte {
+	image := bytes.Repeat([]byte{0xab}, 64)
+
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, []uint16{0, 1, 1})
+	b.Write([]byte{16, 16, 0, 0})
+	binary.Write(&b, binary.LittleEndian, []uint16{1, 32})
+	binary.Write(&b, binary.LittleEndian, []uint32{uint32(len(image)), 22})
+	b.Write(image)
+	return b.Bytes()
+}
+
+// peResources returns the data of the resources in the .rsrc section of
+// a PE file, by type and ID.
+func peResources(t *testing.T, path string) map[[2]uint32][]byte {
+	f, err := pe.Open(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer f.Close()
+
+	sect := f.Section(".rsrc")
+	if sect == nil {
+		t.Fatal("no .rsrc section")
+	}
+	data, err := sect.Data()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	le := binary.LittleEndian
+	entries := func(offset uint32) [][2]uint32 {
+		n := uint32(le.Uint16(data[offset+12:]) + le.Uint16(data[offset+14:]))
+		result := make([][2]uint32, n)
+		for i := uint32(0); i < n; i++ {
+			e := offset + 16 + i*8
+			result[i] = [2]uint32{le.Uint32(data[e:]), le.Uint32(data[e+4:]) &^ 0x80000000}
+		}
+		return result
+	}
+
+	resources := make(map[[2]uint32][]byte)
+	for _, typ := range entries(0) {
+		for _, id := range entries(typ[1]) {
+			for _, lang := range entries(id[1]) {
+				rva := le.Uint32(data[lang[1]:]) - sect.VirtualAddress
+				size := le.Uint32(data[lang[1]+4:])
+				resources[[2]uint32{typ[0], id[0]}] = data[rva : rva+size]
+			}
+		}
+	}
+
+	return resources
+}
+
+func utf16le(s string) []byte {
+	b := make([]byte, 0)
+	for _, c := range utf16.Encode([]rune(s)) {
+		b = binary.LittleEndian.AppendUint16(b, c)
+	}
+	return b
+}
+
+func TestWriteSyso(t *testing.T) {
+	td := t.TempDir()
+	icon := filepath.Join(td, "app.ico")
+	manifest := filepath.Join(td, "app.manifest")
+	if err := os.WriteFile(icon, testIcon(), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := os.WriteFile(manifest, []byte("<assembly/>"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	r := &WindowsResources{
+		Icon:        icon,
+		Manifest:    manifest,
+		VersionInfo: map[string]string{"CompanyName": "Acme", "FileDescription": "{{.Dir}} for {{.Arch}}"},
+	}
+	if err := r.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	data := &OutputTemplateData{Dir: "foo", OS: "windows", Arch: "arm64", GitInfo: GitInfo{Version: "v1.2.3-4-gabcdef0"}}
+	syso := filepath.Join(td, "rsrc_windows_arm64.syso")
+	if err := WriteSyso(syso, "arm64", r, data); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	f, err := pe.Open(syso)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer f.Close()
+
+	if f.Machine != pe.IMAGE_FILE_MACHINE_ARM64 || len(f.Sections) != 1 || f.Sections[0].Name != ".rsrc" {
+		t.Fatalf("bad: %#v", f.FileHeader)
+	}
+	if len(f.Sections[0].Relocs) != 4 || len(f.Symbols) != 1 || f.Symbols[0].Name != ".rsrc" {
+		t.Fatalf("bad: %#v %#v", f.Sections[0].Relocs, f.Symbols)
+	}
+
+	if err := WriteSyso(syso, "arm", r, data); err == nil {
+		t.Fatal("expected error for arm")
+	}
+}
+
+// testModule writes a module with a main package, example.com/app, and
+// the extra files to a temporary directory, and changes into it for the
+// rest of the test.
+func testModule(t *testing.T, files map[string]string) string {
+	td := t.TempDir()
+	files["go.mod"] = "module example.com/app\n\ngo 1.21\n"
+	files["main.go"] = "package main\n\nfunc main() {}\n"
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(td, name), []byte(data), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	// The package is resolved from the module in the working directory.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := os.Chdir(td); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	return td
+}
+
+func TestBuilder_windowsResources(t *testing.T) {
+	td := testModule(t, map[string]string{
+		"app.manifest": "<assembly/>",
+		"app.ico":      string(testIcon()),
+	})
+
+	b := &Builder{
+		Parallel: 2,
+		WindowsResources: &WindowsResources{
+			Icon:        "app.ico",
+			Manifest:    "app.manifest",
+			VersionInfo: map[string]string{"ProductName": "App {{.Version}}"},
+		},
+	}
+	platforms := []Platform{
+		{OS: "windows", Arch: "amd64"},
+		{OS: "windows", Arch: "arm"},
+		{OS: "linux", Arch: "amd64"},
+	}
+	newOpts := func(pkg string, platform Platform) (*CompileOpts, error) {
+		return &CompileOpts{
+			PackagePath: pkg,
+			Platform:    platform,
+			OutputTpl:   filepath.Join(td, "bin", DefaultOutputTpl),
+			GoCmd:       "go",
+			Git:         &GitInfo{Version: "v2.0.1"},
+		}, nil
+	}
+
+	if _, err := b.Plan([]string{"example.com/app"}, platforms, newOpts); err == nil {
+		t.Fatal("expected windows/arm to be unsupported")
+	}
+
+	b.SkipUnsupported = true
+	jobs, err := b.Plan([]string{"example.com/app"}, platforms, newOpts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	results := b.Build(context.Background(), jobs)
+	for _, r := range results {
+		if r.Err != nil {
+			t.Fatalf("%s: %s", r.Job.Platform.String(), r.Err)
+		}
+	}
+	if results[1].Skip == "" {
+		t.Fatalf("bad: %#v", results[1])
+	}
+
+	// The .syso is removed after the build.
+	if matches, _ := filepath.Glob(filepath.Join(td, "*.syso")); len(matches) != 0 {
+		t.Fatalf("bad: %v", matches)
+	}
+
+	resources := peResources(t, results[0].Artifacts[0].Path)
+	if string(resources[[2]uint32{rtManifest, 1}]) != "<assembly/>" {
+		t.Fatalf("bad: %v", resources)
+	}
+	if len(resources[[2]uint32{rtIcon, 1}]) != 64 || len(resources[[2]uint32{rtGroupIcon, 1}]) != 20 {
+		t.Fatalf("bad: %v", resources)
+	}
+
+	version := resources[[2]uint32{rtVersion, 1}]
+	if !bytes.Contains(version, utf16le("App v2.0.1")) {
+		t.Fatalf("bad: %q", version)
+	}
+
+	// The fixed version, 2.0.1.0, follows the key and its padding.
+	fixed := version[40:]
+	if binary.LittleEndian.Uint32(fixed) != 0xfeef04bd ||
+		binary.LittleEndian.Uint32(fixed[8:]) != 2<<16 || binary.LittleEndian.Uint32(fixed[12:]) != 1<<16 {
+		t.Fatalf("bad: %x", fixed[:16])
+	}
+}
+
+func TestFixedVersion(t *testing.T) {
+	cases := []struct {
+		Input  string
+		MS, LS uint32
+	}{
+		{"v1.2.3", 1<<16 | 2, 3 << 16},
+		{"1.2.3.4", 1<<16 | 2, 3<<16 | 4},
+		{"v1.2.3-4-gabcdef0-dirty", 1<<16 | 2, 3<<16 | 4},
+		{"v2", 2 << 16, 0},
+		{"abcdef0", 0, 0},
+	}
+
+	for _, tc := range cases {
+		ms, ls := fixedVersion(tc.Input)
+		if ms != tc.MS || ls != tc.LS {
+			t.Fatalf("bad: %s: %x %x", tc.Input, ms, ls)
+		}
+	}
+}
+
+func TestBuilder_windowsResourcesVariants(t *testing.T) {
+	td := testModule(t, map[string]string{})
+
+	// The variants of a platform are built at the same time, each with
+	// its own resources.
+	b := &Builder{
+		Parallel:         3,
+		WindowsResources: &WindowsResources{VersionInfo: map[string]string{"ProductName": "App {{.Variant}}"}},
+	}
+	platforms := []Platform{
+		{OS: "windows", Arch: "amd64", Variant: "v1"},
+		{OS: "windows", Arch: "amd64", Variant: "v2"},
+		{OS: "windows", Arch: "amd64", Variant: "v3"},
+	}
+	jobs, err := b.Plan([]string{"example.com/app"}, platforms, func(pkg string, platform Platform) (*CompileOpts, error) {
+		return &CompileOpts{
+			PackagePath: pkg,
+			Platform:    platform,
+			OutputTpl:   filepath.Join(td, "bin", DefaultOutputTpl),
+			GoCmd:       "go",
+			Git:         &GitInfo{Version: "v2.0.1"},
+		}, nil
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	results := b.Build(context.Background(), jobs)
+	for i, r := range results {
+		if r.Err != nil {
+			t.Fatalf("%s: %s", r.Job.Platform.String(), r.Err)
+		}
+
+		version := peResources(t, r.Artifacts[0].Path)[[2]uint32{rtVersion, 1}]
+		if !bytes.Contains(version, utf16le("App "+platforms[i].Variant)) {
+			t.Fatalf("%s: bad: %q", platforms[i].String(), version)
+		}
+	}
+
+	if matches, _ := filepath.Glob(filepath.Join(td, "*.syso")); len(matches) != 0 {
+		t.Fatalf("bad: %v", matches)
+	}
+}
@@ -0,0 +1,90 @@
+package gox
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// zigTargets maps the platforms that Zig can cross-compile cgo for to the
+// architecture and OS of their Zig target triple. The ABI, which depends on
+// the libc and the variant, is added by ZigTarget.
+var zigTargets = map[string]string{
+	"darwin/amd64": "x86_64-macos",
+	"darwin/arm64": "aarch64-macos",
+
+	"linux/386":      "x86-linux",
+	"linux/amd64":    "x86_64-linux",
+	"linux/arm":      "arm-linux",
+	"linux/arm64":    "aarch64-linux",
+	"linux/loong64":  "loongarch64-linux",
+	"linux/mips":     "mips-linux",
+	"linux/mipsle":   "mipsel-linux",
+	"linux/mips64":   "mips64-linux",
+	"linux/mips64le": "mips64el-linux",
+	"linux/ppc64le":  "powerpc64le-linux",
+	"linux/riscv64":  "riscv64-linux",
+	"linux/s390x":    "s390x-linux",
+
+	"windows/386":   "x86-windows-gnu",
+	"windows/amd64": "x86_64-windows-gnu",
+	"windows/arm64": "aarch64-windows-gnu",
+}
+
+// cgoLibcRe matches the libcs that can be linked against on Linux: musl,
+// or glibc with an optional minimum version such as "gnu.2.17".
+var cgoLibcRe = regexp.MustCompile(`^(musl|gnu(\.[0-9]+\.[0-9]+)?)$`)
+
+// ValidateCgoLibc returns an error if libc isn't a libc that Zig can link
+// against.
+func ValidateCgoLibc(libc string) error {
+	if !cgoLibcRe.MatchString(libc) {
+		return fmt.Errorf("invalid libc %q, expected gnu, gnu.X.Y or musl", libc)
+	}
+
+	return nil
+}
+
+// ZigTarget returns the Zig target triple for the platform, which is passed
+// to "zig cc -target". libc is only used for Linux and is either "musl" or
+// "gnu", optionally followed by the minimum glibc version as in "gnu.2.17".
+func ZigTarget(p Platform, libc string) (string, error) {
+	target, ok := zigTargets[p.OSArch()]
+	if !ok {
+		return "", fmt.Errorf("zig can't cross-compile cgo for %s", p.OSArch())
+	}
+
+	if p.OS != "linux" {
+		return target, nil
+	}
+
+	if err := ValidateCgoLibc(libc); err != nil {
+		return "", err
+	}
+
+	// The glibc version comes after the ABI, which extends the libc name.
+	name, version, _ := strings.Cut(libc, ".")
+	if version != "" {
+		version = "." + version
+	}
+
+	softfloat := strings.Contains(p.Variant, "softfloat")
+	switch p.Arch {
+	case "arm":
+		if softfloat || p.Variant == "5" {
+			name += "eabi"
+		} else {
+			name += "eabihf"
+		}
+	case "mips", "mipsle":
+		if softfloat {
+			name += "eabi"
+		} else {
+			name += "eabihf"
+		}
+	case "mips64", "mips64le":
+		name += "abi64"
+	}
+
+	return target + "-" + name + version, nil
+}
@@ -0,0 +1,69 @@
+package gox
+
+import (
+	"testing"
+)
+
+func TestZigTarget(t *testing.T) {
+	cases := []struct {
+		Platform Platform
+		Libc     string
+		Expected string
+		Err      bool
+	}{
+		{Platform{OS: "linux", Arch: "amd64"}, "gnu", "x86_64-linux-gnu", false},
+		{Platform{OS: "linux", Arch: "amd64"}, "gnu.2.17", "x86_64-linux-gnu.2.17", false},
+		{Platform{OS: "linux", Arch: "arm64"}, "musl", "aarch64-linux-musl", false},
+		{Platform{OS: "linux", Arch: "arm", Variant: "7"}, "gnu", "arm-linux-gnueabihf", false},
+		{Platform{OS: "linux", Arch: "arm", Variant: "5"}, "musl", "arm-linux-musleabi", false},
+		{Platform{OS: "linux", Arch: "arm", Variant: "6,softfloat"}, "gnu.2.28", "arm-linux-gnueabi.2.28", false},
+		{Platform{OS: "linux", Arch: "mips", Variant: "softfloat"}, "musl", "mips-linux-musleabi", false},
+		{Platform{OS: "linux", Arch: "mips64le"}, "gnu", "mips64el-linux-gnuabi64", false},
+		{Platform{OS: "darwin", Arch: "arm64"}, "musl", "aarch64-macos", false},
+		{Platform{OS: "windows", Arch: "amd64"}, "gnu", "x86_64-windows-gnu", false},
+		{Platform{OS: "linux", Arch: "amd64"}, "uclibc", "", true},
+		{Platform{OS: "plan9", Arch: "386"}, "gnu", "", true},
+	}
+
+	for _, tc := range cases {
+		actual, err := ZigTarget(tc.Platform, tc.Libc)
+		if (err != nil) != tc.Err {
+			t.Fatalf("bad: %s: %v", tc.Platform.String(), err)
+		}
+		if actual != tc.Expected {
+			t.Fatalf("bad: %s: %s", tc.Platform.String(), actual)
+		}
+	}
+}
+
+func TestGoBuildCommand_zig(t *testing.T) {
+	opts := &CompileOpts{
+		PackagePath:  "example.com/foo",
+		Platform:     Platform{OS: "linux", Arch: "arm64"},
+		OutputTpl:    "foo",
+		Cxx:          "clang++",
+		Cgo:          true,
+		GoCmd:        "go",
+		CgoToolchain: "zig",
+		CgoLibc:      "musl",
+	}
+
+	cmd, err := GoBuildCommand(opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []string{
+		"GOOS=linux", "GOARCH=arm64",
+		"CC=zig cc -target aarch64-linux-musl", "CXX=clang++",
+		"CGO_ENABLED=1",
+	}
+	if len(cmd.Env) != len(expected) {
+		t.Fatalf("bad: %#v", cmd.Env)
+	}
+	for i := range expected {
+		if cmd.Env[i] != expected[i] {
+			t.Fatalf("bad: %#v", cmd.Env)
+		}
+	}
+}
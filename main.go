@@ -1,14 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"os/signal"
 	"runtime"
 	"strings"
-	"sync"
+	"syscall"
+	"time"
 
+	"github.com/authelia/gox/gox"
 	"github.com/hashicorp/go-version"
 )
 
@@ -23,12 +29,35 @@ func realMain() int {
 	var ldflags string
 	var outputTpl string
 	var parallel int
-	var platformFlag PlatformFlag
+	var platformFlag gox.PlatformFlag
 	var tags string
 	var verbose bool
 	var flagGcflags, flagAsmflags, flagBuildmode, flagBuildVCS string
 	var flagCgo, flagRebuild, flagTrimPath, flagListOSArch, flagRaceFlag bool
-	var flagGoCmd string
+	var flagGoCmd, flagConfig string
+	var flagCgoToolchain, flagCgoLibc string
+	var flagArchive bool
+	var flagArchiveOutput, flagArchiveFiles string
+	var flagChecksum, flagChecksumOutput string
+	var flagChecksumSidecar bool
+	var flagManifest string
+	var flagSBOM string
+	var flagLogDir string
+	var flagMaxSize, flagCompareManifest string
+	var flagMaxGrowth float64
+	var flagPreHooks, flagPostHooks stringList
+	var flagStamp stringList
+	var flagUniversal, flagUniversalReplace bool
+	var flagCodesign bool
+	var flagEntitlements string
+	var flagJSON, flagFailFast, flagDryRun, flagSkipUnsupported bool
+	var flagSkipVerify bool
+	var flagTimeout time.Duration
+	var flagRetries int
+	flagArchiveFormat := gox.ArchiveFormats{
+		Default: "tar.gz",
+		OS:      map[string]string{"windows": "zip"},
+	}
 	var modMode string
 	flags := flag.NewFlagSet("gox", flag.ExitOnError)
 	flags.Usage = func() { printUsage() }
@@ -37,11 +66,13 @@ func realMain() int {
 	flags.Var(platformFlag.OSFlagValue(), "os", "os to build for or skip")
 	flags.StringVar(&ldflags, "ldflags", "", "linker flags")
 	flags.StringVar(&tags, "tags", "", "go build tags")
-	flags.StringVar(&outputTpl, "output", "{{.Dir}}_{{.OS}}_{{.Arch}}", "output path")
+	flags.StringVar(&outputTpl, "output", gox.DefaultOutputTpl, "output path")
 	flags.IntVar(&parallel, "parallel", -1, "parallelization factor")
 	flags.BoolVar(&buildToolchain, "build-toolchain", false, "build toolchain")
 	flags.BoolVar(&verbose, "verbose", false, "verbose")
 	flags.BoolVar(&flagCgo, "cgo", false, "")
+	flags.StringVar(&flagCgoToolchain, "cgo-toolchain", "", "")
+	flags.StringVar(&flagCgoLibc, "cgo-libc", "gnu", "")
 	flags.BoolVar(&flagRebuild, "rebuild", false, "")
 	flags.BoolVar(&flagTrimPath, "trimpath", false, "")
 	flags.BoolVar(&flagListOSArch, "osarch-list", false, "")
@@ -52,11 +83,86 @@ func realMain() int {
 	flags.StringVar(&flagAsmflags, "asmflags", "", "")
 	flags.StringVar(&flagGoCmd, "gocmd", "go", "")
 	flags.StringVar(&modMode, "mod", "", "")
+	flags.StringVar(&flagConfig, "config", "", "")
+	flags.BoolVar(&flagArchive, "archive", false, "")
+	flags.Var(&flagArchiveFormat, "archive-format", "")
+	flags.StringVar(&flagArchiveOutput, "archive-output", "", "")
+	flags.StringVar(&flagArchiveFiles, "archive-files", "", "")
+	flags.StringVar(&flagChecksum, "checksum", "", "")
+	flags.StringVar(&flagChecksumOutput, "checksum-output", "", "")
+	flags.BoolVar(&flagChecksumSidecar, "checksum-sidecar", false, "")
+	flags.StringVar(&flagManifest, "manifest", "", "")
+	flags.StringVar(&flagSBOM, "sbom", "", "")
+	flags.StringVar(&flagLogDir, "log-dir", "", "")
+	flags.StringVar(&flagMaxSize, "max-size", "", "")
+	flags.StringVar(&flagCompareManifest, "compare-manifest", "", "")
+	flags.Float64Var(&flagMaxGrowth, "max-growth", 0, "")
+	flags.Var(&flagPreHooks, "pre-hook", "")
+	flags.Var(&flagPostHooks, "post-hook", "")
+	flags.Var(&flagStamp, "stamp", "")
+	flags.BoolVar(&flagUniversal, "universal", false, "")
+	flags.BoolVar(&flagUniversalReplace, "universal-replace", false, "")
+	flags.BoolVar(&flagCodesign, "codesign", false, "")
+	flags.StringVar(&flagEntitlements, "entitlements", "", "")
+	flags.BoolVar(&flagJSON, "json", false, "")
+	flags.BoolVar(&flagFailFast, "fail-fast", false, "")
+	flags.BoolVar(&flagDryRun, "dry-run", false, "")
+	flags.BoolVar(&flagSkipUnsupported, "skip-unsupported", false, "")
+	flags.BoolVar(&flagSkipVerify, "skip-verify", false, "")
+	flags.DurationVar(&flagTimeout, "timeout", 0, "")
+	flags.IntVar(&flagRetries, "retries", 0, "")
 	if err := flags.Parse(os.Args[1:]); err != nil {
 		flags.Usage()
 		return 1
 	}
 
+	// Load the project config, if any, and layer the command-line on top.
+	config, err := LoadConfig(flagConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %s\n", err)
+		return 1
+	}
+	if config != nil {
+		if err := config.ApplyFlags(flags); err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading config: %s\n", err)
+			return 1
+		}
+	}
+
+	switch flagCgoToolchain {
+	case "":
+	case "zig":
+		if _, err := exec.LookPath("zig"); err != nil {
+			fmt.Fprintf(os.Stderr, "zig executable must be on the PATH for -cgo-toolchain=zig\n")
+			return 1
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown cgo toolchain: %s\n", flagCgoToolchain)
+		return 1
+	}
+	if err := gox.ValidateCgoLibc(flagCgoLibc); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+
+	var maxSize int64
+	if flagMaxSize != "" {
+		if maxSize, err = gox.ParseSize(flagMaxSize); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -max-size: %s\n", err)
+			return 1
+		}
+	}
+
+	if flagChecksum != "" && flagChecksumOutput == "" {
+		flagChecksumOutput = strings.ToUpper(flagChecksum) + "SUMS"
+	}
+
+	stamp, err := gox.ParseStamp(flagStamp)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing -stamp: %s\n", err)
+		return 1
+	}
+
 	// Determine what amount of parallelism we want Default to the current
 	// number of CPUs-1 is <= 0 is specified.
 	if parallel <= 0 {
@@ -80,38 +186,56 @@ func realMain() int {
 		return mainBuildToolchain(parallel, platformFlag, verbose)
 	}
 
+	// Cancel everything on SIGINT or SIGTERM, killing any running builds.
+	// Once canceled, stop catching the signals so that a second one
+	// terminates gox immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
 	if _, err := exec.LookPath(flagGoCmd); err != nil {
 		fmt.Fprintf(os.Stderr, "%s executable must be on the PATH\n",
 			flagGoCmd)
 		return 1
 	}
 
-	versionStr, err := GoVersion()
+	versionStr, err := gox.GoVersion()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error reading Go version: %s", err)
 		return 1
 	}
+	if !flagJSON {
+		fmt.Printf("Detected Go Version: %s\n", versionStr)
+	}
+
+	supported := gox.ToolchainPlatforms(ctx, flagGoCmd, versionStr)
 
 	if flagListOSArch {
-		return mainListOSArch(versionStr)
+		return mainListOSArch(versionStr, supported)
 	}
 
 	// Determine the packages that we want to compile. Default to the
 	// current directory if none are specified.
 	packages := flags.Args()
+	if len(packages) == 0 && config != nil {
+		packages = config.Packages
+	}
 	if len(packages) == 0 {
 		packages = []string{"."}
 	}
 
 	// Get the packages that are in the given paths
-	mainDirs, err := GoMainDirs(packages, flagGoCmd)
+	mainDirs, err := gox.GoMainDirs(ctx, packages, flagGoCmd)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error reading packages: %s", err)
 		return 1
 	}
 
 	// Determine the platforms we're building for
-	platforms := platformFlag.Platforms(SupportedPlatforms(versionStr))
+	platforms := platformFlag.Platforms(supported)
 	if len(platforms) == 0 {
 		fmt.Println("No valid platforms to build for. If you specified a value")
 		fmt.Println("for the 'os', 'arch', or 'osarch' flags, make sure you're")
@@ -139,70 +263,170 @@ func realMain() int {
 		}
 	}
 
-	// Build in parallel!
-	fmt.Printf("Number of parallel builds: %d\n\n", parallel)
-	var errorLock sync.Mutex
-	var wg sync.WaitGroup
-	errors := make([]string, 0)
-	semaphore := make(chan int, parallel)
-	for _, platform := range platforms {
-		for _, path := range mainDirs {
-			// Start the goroutine that will do the actual build
-			wg.Add(1)
-			go func(path string, platform Platform) {
-				defer wg.Done()
-				semaphore <- 1
-				fmt.Printf("--> %15s: %s\n", platform.String(), path)
-
-				opts := &CompileOpts{
-					PackagePath: path,
-					Platform:    platform,
-					OutputTpl:   outputTpl,
-					Ldflags:     ldflags,
-					Gcflags:     flagGcflags,
-					Asmflags:    flagAsmflags,
-					Tags:        tags,
-					ModMode:     modMode,
-					Cgo:         flagCgo,
-					Rebuild:     flagRebuild,
-					Buildmode:   flagBuildmode,
-					BuildVCS:    flagBuildVCS,
-					TrimPath:    flagTrimPath,
-					GoCmd:       flagGoCmd,
-					Race:        flagRaceFlag,
-				}
-
-				// Determine if we have specific CFLAGS or LDFLAGS for this
-				// GOOS/GOARCH combo and override the defaults if so.
-				envOverride(&opts.Ldflags, platform, "LDFLAGS")
-				envOverride(&opts.Gcflags, platform, "GCFLAGS")
-				envOverride(&opts.Asmflags, platform, "ASMFLAGS")
-				envOverride(&opts.Cc, platform, "CC")
-				envOverride(&opts.Cxx, platform, "CXX")
-
-				if err := GoCrossCompile(opts); err != nil {
-					errorLock.Lock()
-					defer errorLock.Unlock()
-					errors = append(errors,
-						fmt.Sprintf("%s error: %s", platform.String(), err))
-				}
-				<-semaphore
-			}(path, platform)
+	var reporter gox.Reporter = gox.NewHumanReporter(os.Stdout, os.Stderr)
+	if flagJSON {
+		reporter = gox.NewJSONReporter(os.Stdout)
+	}
+
+	builder := &gox.Builder{
+		Parallel: parallel,
+		Retry: gox.RetryOpts{
+			Timeout: flagTimeout,
+			Retries: flagRetries,
+		},
+		FailFast:        flagFailFast,
+		SkipUnsupported: flagSkipUnsupported,
+		SkipVerify:      flagSkipVerify,
+		SBOM:            strings.Fields(flagSBOM),
+		HasCgo:          gox.CgoKnown(supported),
+		GoVersion:       versionStr,
+		Reporter:        reporter,
+		PreHooks:        flagPreHooks,
+		PostHooks:       flagPostHooks,
+
+		Universal:        flagUniversal || flagUniversalReplace,
+		UniversalReplace: flagUniversalReplace,
+
+		Codesign:     flagCodesign || flagEntitlements != "",
+		Entitlements: flagEntitlements,
+
+		WindowsResources: config.windowsResources(),
+		Manifest:         flagManifest,
+	}
+	if verbose || flagLogDir != "" {
+		// Keep the streamed output off stdout with -json, so that it
+		// only has events.
+		var console io.Writer
+		if verbose {
+			console = os.Stdout
+			if flagJSON {
+				console = os.Stderr
+			}
+		}
+
+		builder.Log = func(job *gox.Job) (io.WriteCloser, error) {
+			return newBuildLog(job, console, flagLogDir)
+		}
+	}
+	if flagArchive {
+		builder.Archive = &gox.ArchiveConfig{
+			Formats:   flagArchiveFormat,
+			OutputTpl: flagArchiveOutput,
+			Files:     strings.Fields(flagArchiveFiles),
 		}
 	}
-	wg.Wait()
+	if flagChecksum != "" {
+		builder.Checksum = &gox.ChecksumOpts{
+			Algorithm: flagChecksum,
+			Output:    flagChecksumOutput,
+			Sidecar:   flagChecksumSidecar,
+		}
+	}
+
+	// The options of each build are the flags, once the config and the
+	// environment have overridden them for the package and platform.
+	optsFactory := &gox.OptsFactory{
+		Base: gox.CompileOpts{
+			OutputTpl: outputTpl,
+			Ldflags:   ldflags,
+			Gcflags:   flagGcflags,
+			Asmflags:  flagAsmflags,
+			Tags:      tags,
+			ModMode:   modMode,
+			Cgo:       flagCgo,
+			Rebuild:   flagRebuild,
+			Buildmode: flagBuildmode,
+			BuildVCS:  flagBuildVCS,
+			TrimPath:  flagTrimPath,
+			GoCmd:     flagGoCmd,
+			Race:      flagRaceFlag,
+
+			CgoToolchain: flagCgoToolchain,
+			CgoLibc:      flagCgoLibc,
+
+			MaxSize: maxSize,
+			Verbose: verbose,
+
+			Stamp: stamp,
+		},
+		Package:          config.packageMaxSize,
+		Overrides:        config.override,
+		Templates:        builder.Templates(),
+		WindowsResources: builder.WindowsResources != nil,
+		Warn: func(err error) {
+			fmt.Fprintf(os.Stderr, "Warning: error reading git information: %s\n", err)
+		},
+	}
+
+	// Determine the options for every build upfront, so that unsupported
+	// combinations are caught before any build is started.
+	jobs, err := builder.Plan(mainDirs, platforms, optsFactory.New)
+	if err != nil {
+		var unsupported *gox.UnsupportedError
+		if !errors.As(err, &unsupported) {
+			fmt.Fprintf(os.Stderr, "Error planning builds: %s\n", err)
+			return 1
+		}
+
+		fmt.Fprintf(os.Stderr, "%s, use -skip-unsupported to skip them:\n", err)
+		for _, job := range unsupported.Jobs {
+			fmt.Fprintf(os.Stderr, "--> %s: %s\n", job.Platform.String(), job.Skip)
+		}
+		return 1
+	}
+
+	if !flagJSON {
+		for _, job := range jobs {
+			if job.Skip != "" {
+				fmt.Fprintf(os.Stderr, "Skipping %s: %s\n", job.Platform.String(), job.Skip)
+			}
+		}
+	}
+
+	if flagDryRun {
+		return mainDryRun(jobs, flagJSON)
+	}
+
+	// Build in parallel!
+	start := time.Now()
+	results := builder.Build(ctx, jobs)
+	if !flagJSON {
+		printSummary(os.Stdout, results, time.Since(start))
+	}
+	if gox.Failed(results) > 0 || ctx.Err() != nil {
+		return 1
+	}
+
+	artifacts := gox.Artifacts(results)
 
-	if len(errors) > 0 {
-		fmt.Fprintf(os.Stderr, "\n%d errors occurred:\n", len(errors))
-		for _, err := range errors {
-			fmt.Fprintf(os.Stderr, "--> %s\n", err)
+	if flagCompareManifest != "" {
+		if code := mainCompareManifest(flagCompareManifest, artifacts, flagMaxGrowth, flagJSON); code != 0 {
+			return code
 		}
+	}
+
+	// Only write checksums once every build has succeeded, so that a
+	// checksum file never covers a partial set of artifacts.
+	if err := builder.WriteArtifacts(artifacts); err != nil {
+		fmt.Fprintf(os.Stderr, "Error %s\n", err)
 		return 1
 	}
 
 	return 0
 }
 
+// stringList is a flag.Value that collects every value it is given.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ", ")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
 func printUsage() {
 	fmt.Fprintf(os.Stderr, helpText, metaVersion)
 }
@@ -219,12 +443,32 @@ const helpText = `Usage: gox [options] [packages]
 Options:
 
   -arch=""            Space-separated list of architectures to build for
+  -archive            Package each binary into an archive, see below
+  -archive-files=""   Space-separated globs of extra files to archive
+  -archive-format=""  Archive formats, defaults to "tar.gz windows=zip"
+  -archive-output=""  Archive path template, defaults to the output path
   -build-toolchain    Build cross-compilation toolchain
+  -config=""          Config file, defaults to gox.toml, gox.yaml or gox.yml
+  -checksum=""        Checksum algorithm for artifacts: sha256, sha512, blake2b
+  -checksum-output="" Checksum file path, defaults to SHA256SUMS etc.
+  -checksum-sidecar   Also write a checksum file next to each artifact
   -cgo                Sets CGO_ENABLED=1, requires proper C toolchain (advanced)
-  -gcflags=""         Additional '-gcflags' value to pass to go build
-  -ldflags=""         Additional '-ldflags' value to pass to go build
-  -asmflags=""        Additional '-asmflags' value to pass to go build
-  -tags=""            Additional '-tags' value to pass to go build
+  -cgo-toolchain=""   C toolchain for cgo, "zig" to cross-compile with Zig
+  -cgo-libc="gnu"     Linux libc for Zig: gnu, gnu.X.Y (minimum glibc) or musl
+  -codesign           Ad-hoc code sign the darwin binaries, see below
+  -dry-run            Print the builds that would run without running them
+  -entitlements=""    Entitlements plist to code sign with, implies -codesign
+  -fail-fast          Cancel the remaining builds after the first failure
+  -gcflags=""         Additional '-gcflags' value to pass to go build, a template
+  -json               Output newline-delimited JSON events, see below
+  -ldflags=""         Additional '-ldflags' value to pass to go build, a template
+  -log-dir=""         Write the output of each build to a log file in this dir
+  -asmflags=""        Additional '-asmflags' value to pass to go build, a template
+  -tags=""            Additional '-tags' value to pass to go build, a template
+  -manifest=""        Write a JSON manifest of every artifact to this path
+  -max-size=""        Size budget of every binary, e.g. "20MiB", see below
+  -compare-manifest="" Compare binary sizes with a previous -manifest
+  -max-growth=0       Fail if a binary grew by more than this percentage
   -mod=""             Additional '-mod' value to pass to go build
   -buildmode=""       Additional '-buildmode' value to pass to go build
   -os=""              Space-separated list of operating systems to build for
@@ -232,18 +476,286 @@ Options:
   -osarch-list        List supported os/arch pairs for your Go version
   -output="foo"       Output path template. See below for more info
   -parallel=-1        Amount of parallelism, defaults to number of CPUs
+  -pre-hook=""        Command to run before each build, may be repeated
+  -post-hook=""       Command to run after each build, may be repeated
   -race               Build with the go race detector enabled, requires CGO
   -gocmd="go"         Build command, defaults to Go
   -rebuild            Force rebuilding of package that were up to date
+  -retries=0          Number of times to retry a failed build, with backoff
+  -timeout=0          Maximum duration of each build, e.g. "10m"
+  -sbom=""            SBOM formats to write next to each binary: cyclonedx, spdx
+  -skip-unsupported   Skip, rather than fail on, unsupported platforms
+  -skip-verify        Don't check that each binary is for its platform, see below
+  -stamp=""           Set a symbol to git information, e.g. "main.version=version"
   -trimpath           Remove all file system paths from the resulting executable
-  -verbose            Verbose mode
+  -universal          Merge darwin/amd64 and darwin/arm64 into a universal binary
+  -universal-replace  Like -universal, and remove the thin darwin binaries
+  -verbose            Stream the output of each build, see below
 
 Output path template:
 
   The output path for the compiled binaries is specified with the
   "-output" flag. The value is a string that is a Go text template.
-  The default value is "{{.Dir}}_{{.OS}}_{{.Arch}}". The variables and
-  their values should be self-explanatory.
+  The default value is "{{.Dir}}_{{.OS}}_{{.Arch}}", followed by
+  "_{{.Variant}}" for platforms with a variant. The variables are:
+
+    {{.Dir}}        - The last element of the package's import path
+    {{.ImportPath}} - The import path of the package
+    {{.OS}}         - The operating system, e.g. "linux"
+    {{.Arch}}       - The architecture, e.g. "arm"
+    {{.Variant}}    - The variant of the architecture, if any, e.g. "7"
+    {{.Env.NAME}}   - The environment variable NAME, or empty if unset
+
+  See "Version Stamping" for the variables with the version of the
+  repository.
+
+  The "-ldflags", "-gcflags", "-asmflags" and "-tags" values, including
+  those from overrides, are templates with the same variables, so that a
+  single value can differ by platform:
+
+    gox -ldflags="-X main.platform={{.OS}}/{{.Arch}}"
+
+Archives:
+
+  With the "-archive" flag each binary is packaged, along with any extra
+  files matched by "-archive-files", into an archive. The format is one of
+  "tar.gz", "tar.zst" or "zip", and may be set per OS with an "os=format"
+  entry in "-archive-format". The archive path is the binary's output path
+  without ".exe", or the "-archive-output" template which takes the same
+  variables as "-output", followed by the format's extension. Extra files
+  keep their relative path, except those outside of the current directory,
+  such as "../LICENSE", which are placed at the root of the archive.
+  Archives are reproducible: files have fixed owners, permissions and
+  modification times, which may be set with the SOURCE_DATE_EPOCH
+  environment variable.
+
+Checksums:
+
+  With the "-checksum" flag a checksum file is written covering every
+  binary, archive and SBOM once all builds have succeeded. It uses the format
+  of sha256sum, sha512sum and b2sum, with paths relative to the checksum
+  file, so it may be verified with e.g. "sha256sum -c SHA256SUMS". The
+  "-checksum-sidecar" flag also writes a file such as "foo.sha256" next to
+  each artifact.
+
+SBOMs:
+
+  With the "-sbom" flag an SBOM is written next to each binary, including
+  universal binaries, in each of the space-separated formats: "cyclonedx"
+  for CycloneDX 1.5 JSON, as "foo.cdx.json", and "spdx" for SPDX 2.3 JSON,
+  as "foo.spdx.json". It is read from the build information embedded in
+  the binary, so it lists the modules that were actually linked: the main
+  module and every dependency with its version and go.sum checksum, along
+  with the Go version and the build settings. SBOMs are recorded in the
+  manifest, both on their own and in the "sboms" of their binary, and are
+  reproducible like archives.
+
+    gox -sbom="cyclonedx spdx" -manifest=manifest.json
+
+Manifest:
+
+  With the "-manifest" flag a JSON manifest is written once all builds have
+  succeeded. It lists every binary, archive and SBOM along with its import
+  path, platform, path, size, checksum (using the "-checksum" algorithm, or
+  sha256), build duration, the effective flags after the platform
+  overrides, whether cgo was enabled and the Go version used.
+
+JSON Output:
+
+  With the "-json" flag the progress of the builds is written to stdout as
+  newline-delimited JSON events instead of text. Each event has a "Time"
+  and an "Action", which is one of:
+
+    plan     the builds are about to start; has GoVersion, Packages,
+             Platforms and Parallel
+    start    a build started; has Package and Platform
+    output   a build failed; Output has its standard error
+    pass     a build succeeded; has Elapsed seconds
+    fail     a build failed; has Elapsed seconds, the ExitCode of go
+             build if it ran, the number of Attempts if it was retried
+             and Timeout if the final attempt timed out
+    skip     a build was skipped; Output has the reason, e.g. "canceled"
+    summary  every build finished; has Elapsed seconds, Passed, Failed
+             and Skipped
+
+  Fields are omitted when they're empty or zero. New fields and actions
+  may be added, but existing ones won't change meaning.
+
+Unsupported Platforms:
+
+  Before any build is started, Gox checks that every platform supports the
+  race detector if "-race" is given, the "-buildmode" if one is given, and
+  cgo if it is enabled with "-cgo" or a CGO_ENABLED override. If any don't,
+  Gox fails listing them, or with "-skip-unsupported" skips them with a
+  warning and builds the rest.
+
+Cgo Toolchains:
+
+  Cross-compiling with cgo needs a C compiler for every target, normally
+  set per platform with the CC and CXX overrides. With "-cgo-toolchain=zig"
+  Gox instead uses "zig cc" and "zig c++" with the target triple of each
+  platform, such as "aarch64-linux-gnu" or "x86_64-windows-gnu", for any
+  platform that doesn't set CC or CXX itself. Zig must be on the PATH.
+
+  On Linux, "-cgo-libc" selects glibc ("gnu", optionally with a minimum
+  version as in "gnu.2.17") or "musl". Platforms that Zig can't build for
+  are reported before any build starts, the same as unsupported platforms.
+
+Build Logs:
+
+  With "-verbose", each build runs "go build -v -x" and its output is
+  streamed as it runs, every line prefixed with the platform. With "-json"
+  it goes to stderr instead of stdout.
+
+  With "-log-dir", the output of each build is also written to a file in
+  that directory, named after the import path and the platform with a
+  ".log" extension, e.g. "example.com_app_linux_amd64.log". It's kept
+  whether or not the build succeeds. It only has the "-v -x" output with
+  "-verbose" as well, so that on its own it doesn't bury the errors of a
+  failed build.
+
+Summary:
+
+  Once every build is done, Gox prints a table of the builds with the
+  status, build time, binary size and whether cgo was enabled for each,
+  followed by the total CPU time spent building, the wall time and the
+  effective parallelism, which is the ratio of the two.
+
+Hooks:
+
+  The "-pre-hook" and "-post-hook" commands run before and after each
+  build, in the order they are given, e.g. to run "go generate" or to
+  compress or sign the binary. Each is a template with the same data as
+  the output path, along with:
+
+    {{.Package}} - The import path of the package
+    {{.Output}}  - The absolute path to the binary
+
+  Hooks are run by the shell, sh or cmd on Windows, in the directory of
+  the package with the environment of the build, such as GOOS and GOARCH,
+  and count towards "-parallel".
+  Their output is treated like that of the build and a hook that fails
+  fails the build. Post-build hooks run before the size budget is checked
+  and before the binary is archived.
+
+    gox -post-hook="upx -q {{.Output}}" ./cmd/app
+
+Size Budgets:
+
+  A build fails if its binary is larger than its size budget. The budget
+  is set for every binary with "-max-size", for a package with the
+  "package-max-size" table in the config file, and for a platform with the
+  MAX_SIZE override, each taking precedence over the one before. Sizes
+  are in bytes or with a unit: KiB, MiB and GiB or K, M and G are powers
+  of 1024, KB, MB and GB are powers of 1000.
+
+  With "-compare-manifest", the size of every binary is compared with the
+  one of the same package and platform in a manifest from a previous
+  build, written with "-manifest", and the changes are printed. With
+  "-max-growth" as well, Gox fails if any binary grew by more than that
+  percentage. Both run after all of the builds succeed, before checksums
+  and the manifest are written, so the previous manifest can be the one
+  that is about to be replaced.
+
+Version Stamping:
+
+  Gox reads the version information of the current commit of the git
+  repository of each package directly from its .git directory, only if
+  a template or "-stamp" uses it. It is available to the "-output" and
+  flag templates, and to hooks and archive paths:
+
+    {{.Version}}     - Like "git describe --tags --always --dirty"
+    {{.Tag}}         - The nearest tag, if any
+    {{.Commit}}      - The full commit hash
+    {{.ShortCommit}} - The commit hash abbreviated to 7 characters
+    {{.Dirty}}       - Whether tracked files have uncommitted changes
+    {{.CommitDate}}  - The commit date in RFC 3339 format, in UTC
+
+  With "-stamp", which may be repeated, a symbol is set to one of the
+  fields version, tag, commit, short-commit, dirty or commit-date using
+  the linker's -X flag. The following are equivalent:
+
+    gox -stamp=main.version=version -stamp=main.commit=commit
+    gox -ldflags="-X main.version={{.Version}} -X main.commit={{.Commit}}"
+
+  "-stamp" fails outside of a git repository. In the config file it is a
+  table of symbols to fields named "stamp".
+
+Universal Binaries:
+
+  With "-universal", once the darwin/amd64 and darwin/arm64 binaries of a
+  package are built they are merged into a universal binary that runs on
+  both, like "lipo -create" would but without needing it. Its output path
+  is the "-output" template with "universal" as {{.Arch}}, and it is
+  verified, held to the "-max-size" of the darwin/arm64 binary, archived
+  and recorded in the manifest like any other binary. With
+  "-universal-replace" the thin binaries are removed once it is done,
+  along with their archives and SBOMs, and are left out of the checksums
+  and the manifest. Packages that aren't built for both are left alone.
+
+    gox -osarch="darwin/amd64 darwin/arm64" -universal-replace
+
+Verification:
+
+  Each binary is checked right after it is built, before any post-build
+  hook, to be for the platform it was built for: its file format, machine
+  type and bitness, and the GOOS, GOARCH, variant, CGO_ENABLED and tags in
+  its build information. A binary that isn't, such as one built for amd64
+  because GOARCH leaked in from the environment, fails the build. Use
+  "-skip-verify" to skip this, e.g. when "-gocmd" doesn't build with Go.
+
+Code Signing:
+
+  Binaries for darwin/arm64 only run on macOS once they are code signed.
+  The Go linker signs them itself, but only for some builds, and any
+  post-build hook that changes the binary breaks the signature. With
+  "-codesign" every darwin binary is given an ad-hoc signature after the
+  post-build hooks, on any OS and without needing codesign, so universal
+  binaries are made from signed binaries. The identifier is the name of
+  the binary. With "-entitlements" the signature also has the entitlements
+  in that XML property list, both as XML and in the DER form that macOS
+  checks. They may only have dicts, arrays, strings, integers and booleans.
+
+    gox -os=darwin -entitlements=app.entitlements
+
+  An ad-hoc signature isn't an identity: binaries downloaded from the
+  internet still need a Developer ID signature and notarization.
+
+Windows Resources:
+
+  With a "windows-resources" table in the config file, the binaries for
+  Windows on 386, amd64 and arm64 get file properties, an icon and an
+  application manifest. A .syso file is generated for each build, without
+  needing windres, into the directory of the package and removed once the
+  build is done. Other Windows architectures are unsupported.
+
+    [windows-resources]
+    icon = "assets/app.ico"
+    manifest = "assets/app.manifest"
+
+    [windows-resources.version-info]
+    CompanyName = "Acme"
+    FileDescription = "{{.Dir}}"
+    ProductName = "App {{.Version}}"
+
+  The version-info strings take the same variables as "-output".
+  FileVersion and ProductVersion default to {{.Version}}, and their leading
+  numbers set the numeric version, e.g. 1.2.3.4 for "v1.2.3-4-gabcdef0".
+
+Dry Run:
+
+  With the "-dry-run" flag nothing is built. Instead, for each package and
+  platform that would be built, the output path and the exact go build
+  command, working directory and environment variables set by Gox (after
+  the platform overrides) are printed. With "-json" the same is printed as
+  a JSON array.
+
+Cancellation:
+
+  On SIGINT (Ctrl-C) or SIGTERM every running go build, along with the
+  compilers and linkers it started, is killed and its partial output is
+  removed. Builds that hadn't started are skipped. With "-fail-fast" the
+  same happens as soon as one build fails.
 
 Platforms (OS/Arch):
 
@@ -259,21 +771,65 @@ Platforms (OS/Arch):
   expect: "darwin/amd64" would be a valid osarch value. Multiple can be space
   separated. An os/arch pair can begin with "!" to not build for that platform.
 
+  An os/arch pair may be followed by an architecture variant to build for,
+  such as "linux/arm/7" or "linux/amd64/v3". The variant is passed to the
+  build as GOARM, GOAMD64, GO386, GOMIPS, GOMIPS64, GOPPC64 or GORISCV64
+  depending on the arch, so several variants can be built in one run.
+  Negating an os/arch pair negates all of its variants.
+
   The "-osarch" flag has the highest precedent when determining whether to
   build for a platform. If it is included in the "-osarch" list, it will be
   built even if the specific os and arch is negated in "-os" and "-arch",
   respectively.
 
-Platform Overrides:
+Config File:
 
-  The "-gcflags", "-ldflags" and "-asmflags" options and "CC"/"CXX" environment
-  variables for cross-compilation can be overridden per-platform by using
-  environment variables. Gox will look for environment variables in the
-  following format and use those to override values if they exist:
+  Every option above, except -build-toolchain and -osarch-list, may also
+  be set in a TOML or YAML config file along with the "packages" to build.
+  Options given on the command-line take precedence over the config file.
+  Per-platform overrides are set in the "overrides" table, keyed by os/arch,
+  with the names of the GOX_* variables below in lowercase and with
+  hyphens, such as "cgo-enabled" or "max-size". Unknown keys are an error.
+
+    osarch = ["linux/amd64", "linux/arm"]
+    ldflags = "-s -w"
+
+    [overrides."linux/arm"]
+    cc = "arm-linux-gnueabihf-gcc"
+    cgo-enabled = true
+
+Platform Overrides:
 
-    GOX_[OS]_[ARCH]_GCFLAGS
-    GOX_[OS]_[ARCH]_LDFLAGS
-    GOX_[OS]_[ARCH]_ASMFLAGS
-    GOX_[OS]_[ARCH]_CC
-    GOX_[OS]_[ARCH]_CXX
+  Most options, along with the cgo and compiler environment variables, can
+  be overridden per-platform by using environment variables. Gox will look
+  for environment variables in the following format and use those to
+  override values if they exist:
+
+    GOX_[LEVEL]_LDFLAGS
+    GOX_[LEVEL]_GCFLAGS
+    GOX_[LEVEL]_ASMFLAGS
+    GOX_[LEVEL]_TAGS
+    GOX_[LEVEL]_BUILDMODE
+    GOX_[LEVEL]_TRIMPATH
+    GOX_[LEVEL]_OUTPUT
+    GOX_[LEVEL]_CGO_ENABLED
+    GOX_[LEVEL]_CGO_CFLAGS
+    GOX_[LEVEL]_CGO_LDFLAGS
+    GOX_[LEVEL]_CC
+    GOX_[LEVEL]_CXX
+    GOX_[LEVEL]_ENV_[NAME]
+
+  The level is one of [OS], [ARCH], [OS]_[ARCH] or [OS]_[ARCH]_[VARIANT],
+  which are applied in that order so that the most specific one wins, e.g.
+  GOX_LINUX_ARM64_LDFLAGS takes precedence over GOX_ARM64_LDFLAGS, which
+  takes precedence over GOX_LINUX_LDFLAGS. GOX_[LEVEL]_ENV_[NAME] sets the
+  environment variable [NAME] for the build. A value starting with "+" is
+  appended to the value it overrides instead of replacing it, e.g.
+  GOX_LINUX_LDFLAGS="+-extldflags=-static".
+
+  These environment variables take precedence over the "overrides" in the
+  config file for the same level, which are keyed by "os", "arch",
+  "os/arch" or "os/arch/variant" and follow the same rules, but not over
+  those for a more specific level: [overrides."linux/arm"] wins over
+  GOX_LINUX_LDFLAGS.
 `
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/authelia/gox/gox"
+)
+
+// dryRunJob is a single build printed by -dry-run -json.
+type dryRunJob struct {
+	Package  string
+	Platform string
+	Output   string
+	Dir      string   `json:",omitempty"`
+	Env      []string `json:",omitempty"`
+	Args     []string
+}
+
+func mainDryRun(jobs []*gox.Job, jsonOutput bool) int {
+	results := make([]dryRunJob, 0, len(jobs))
+	for _, job := range jobs {
+		if job.Skip != "" {
+			continue
+		}
+
+		cmd, err := gox.GoBuildCommand(job.Opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s error: %s\n", job.Platform.String(), err)
+			return 1
+		}
+
+		results = append(results, dryRunJob{
+			Package:  job.Package,
+			Platform: job.Platform.String(),
+			Output:   cmd.Output,
+			Dir:      cmd.Dir,
+			Env:      cmd.Env,
+			Args:     append([]string{cmd.GoCmd}, cmd.Args...),
+		})
+	}
+
+	if jsonOutput {
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return 1
+		}
+
+		fmt.Printf("%s\n", data)
+		return 0
+	}
+
+	for _, job := range results {
+		fmt.Printf("--> %15s: %s\n", job.Platform, job.Package)
+		fmt.Printf("    output: %s\n", job.Output)
+		if job.Dir != "" {
+			fmt.Printf("    dir:    %s\n", job.Dir)
+		}
+		fmt.Printf("    env:    %s\n", shellJoin(job.Env))
+		fmt.Printf("    cmd:    %s\n", shellJoin(job.Args))
+	}
+
+	return 0
+}
+
+// shellJoin joins the arguments into a string, quoting those that would
+// otherwise be split or expanded by a shell.
+func shellJoin(args []string) string {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'\\$`*?[]{}()<>|&;#~") {
+			arg = strconv.Quote(arg)
+		}
+
+		quoted = append(quoted, arg)
+	}
+
+	return strings.Join(quoted, " ")
+}
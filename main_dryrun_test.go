@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestShellJoin(t *testing.T) {
+	cases := []struct {
+		Args   []string
+		Result string
+	}{
+		{[]string{"go", "build", "-o", "foo"}, "go build -o foo"},
+		{[]string{"-ldflags", "-s -w"}, `-ldflags "-s -w"`},
+		{[]string{"-ldflags", "-X main.v=$VERSION"}, `-ldflags "-X main.v=$VERSION"`},
+		{[]string{"-tags", ""}, `-tags ""`},
+	}
+
+	for _, tc := range cases {
+		if result := shellJoin(tc.Args); result != tc.Result {
+			t.Errorf("input: %#v\nresult: %s", tc.Args, result)
+		}
+	}
+}
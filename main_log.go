@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/authelia/gox/gox"
+	"github.com/mitchellh/iochan"
+)
+
+// prefixWriter writes every line written to it to another writer, prefixed
+// with the platform it came from.
+type prefixWriter struct {
+	w      *io.PipeWriter
+	doneCh chan struct{}
+}
+
+func newPrefixWriter(w io.Writer, prefix string) *prefixWriter {
+	r, pw := io.Pipe()
+
+	// Read the lines in the background, and make a done channel so that
+	// closing waits until all of the output has been written.
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		for line := range iochan.DelimReader(r, '\n') {
+			fmt.Fprintf(w, "%s: %s", prefix, line)
+		}
+	}()
+
+	return &prefixWriter{w: pw, doneCh: doneCh}
+}
+
+func (p *prefixWriter) Write(data []byte) (int, error) {
+	return p.w.Write(data)
+}
+
+func (p *prefixWriter) Close() error {
+	err := p.w.Close()
+	<-p.doneCh
+	return err
+}
+
+// buildLog is the log of a single build, streamed to the console and
+// written to a file in the log directory.
+type buildLog struct {
+	io.Writer
+	closers []io.Closer
+}
+
+// newBuildLog returns the log for the job. The output is streamed to
+// console, if it isn't nil, and written to a file in dir, if it isn't
+// empty.
+func newBuildLog(job *gox.Job, console io.Writer, dir string) (*buildLog, error) {
+	l := &buildLog{}
+	writers := make([]io.Writer, 0, 2)
+
+	if dir != "" {
+		path := buildLogPath(dir, job)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+
+		writers = append(writers, f)
+		l.closers = append(l.closers, f)
+	}
+
+	if console != nil {
+		w := newPrefixWriter(console, job.Platform.String())
+		writers = append(writers, w)
+		l.closers = append(l.closers, w)
+	}
+
+	l.Writer = io.MultiWriter(writers...)
+	return l, nil
+}
+
+func (l *buildLog) Close() error {
+	var err error
+	for _, c := range l.closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+// buildLogPath returns the path to the log file of the job in dir, which
+// is named after the full import path of the package and the platform,
+// so that packages with the same name don't share a log.
+func buildLogPath(dir string, job *gox.Job) string {
+	parts := []string{job.Package, job.Platform.OS, job.Platform.Arch}
+	if job.Platform.Variant != "" {
+		parts = append(parts, job.Platform.Variant)
+	}
+
+	// Anything but letters, digits, dots and dashes, such as the slashes of
+	// the import path, is replaced so that the name is a single file.
+	name := strings.Map(func(r rune) rune {
+		if r < 0x80 && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '-') {
+			return r
+		}
+		return '_'
+	}, strings.Join(parts, "_"))
+
+	return filepath.Join(dir, name+".log")
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/authelia/gox/gox"
+)
+
+func TestBuildLog(t *testing.T) {
+	dir := t.TempDir()
+	platform := gox.Platform{OS: "linux", Arch: "arm", Variant: "7"}
+	job := &gox.Job{
+		Package:  "example.com/foo",
+		Platform: platform,
+		Opts:     &gox.CompileOpts{PackagePath: "example.com/foo", Platform: platform},
+	}
+
+	var console bytes.Buffer
+	l, err := newBuildLog(job, &console, dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	l.Write([]byte("first\nsec"))
+	l.Write([]byte("ond\n"))
+	if err := l.Close(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := "linux/arm/7: first\nlinux/arm/7: second\n"
+	if console.String() != expected {
+		t.Fatalf("bad: %q", console.String())
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "example.com_foo_linux_arm_7.log"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(data) != "first\nsecond\n" {
+		t.Fatalf("bad: %q", data)
+	}
+}
+
+func TestBuildLogPath(t *testing.T) {
+	cases := []struct {
+		Package  string
+		Platform gox.Platform
+		Expected string
+	}{
+		{"example.com/a/cmd/app", gox.Platform{OS: "linux", Arch: "amd64"}, "example.com_a_cmd_app_linux_amd64.log"},
+		{"example.com/b/cmd/app", gox.Platform{OS: "linux", Arch: "amd64"}, "example.com_b_cmd_app_linux_amd64.log"},
+		{"example.com/b/cmd/app", gox.Platform{OS: "linux", Arch: "arm", Variant: "6"}, "example.com_b_cmd_app_linux_arm_6.log"},
+		{"_/tmp/my app", gox.Platform{OS: "linux", Arch: "amd64"}, "__tmp_my_app_linux_amd64.log"},
+	}
+
+	for _, tc := range cases {
+		path := buildLogPath("logs", &gox.Job{Package: tc.Package, Platform: tc.Platform})
+		if path != filepath.Join("logs", tc.Expected) {
+			t.Fatalf("bad: %s", path)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/authelia/gox/gox"
+)
+
+// printSizeDeltas prints a table of the change in size of every binary
+// since the previous build, sorted by package and platform.
+func printSizeDeltas(w io.Writer, previous string, deltas []gox.SizeDelta) {
+	sort.SliceStable(deltas, func(i, j int) bool {
+		a, b := deltas[i].Artifact, deltas[j].Artifact
+		if a.ImportPath != b.ImportPath {
+			return a.ImportPath < b.ImportPath
+		}
+
+		return artifactPlatform(&a) < artifactPlatform(&b)
+	})
+
+	fmt.Fprintf(w, "\nSize changes since %s:\n", previous)
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "PACKAGE\tPLATFORM\tOLD\tNEW\tDELTA")
+	for _, d := range deltas {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			d.Artifact.ImportPath, artifactPlatform(&d.Artifact),
+			gox.FormatSize(d.OldSize), gox.FormatSize(d.Size), formatDelta(&d))
+	}
+	tw.Flush()
+}
+
+// sizeRegressions returns an error message for every binary that grew by
+// more than maxGrowth percent.
+func sizeRegressions(deltas []gox.SizeDelta, maxGrowth float64) []string {
+	regressions := make([]string, 0)
+	for _, d := range deltas {
+		if d.Growth() > maxGrowth {
+			regressions = append(regressions, fmt.Sprintf(
+				"%s: %s grew by %s, more than %g%%",
+				artifactPlatform(&d.Artifact), d.Artifact.ImportPath, formatDelta(&d), maxGrowth))
+		}
+	}
+
+	return regressions
+}
+
+// formatDelta formats the change in size, e.g. "+1.2 MiB (+10.5%)".
+func formatDelta(d *gox.SizeDelta) string {
+	diff := d.Size - d.OldSize
+	sign := "+"
+	if diff < 0 {
+		sign = "-"
+		diff = -diff
+	}
+
+	return fmt.Sprintf("%s%s (%+.1f%%)", sign, gox.FormatSize(diff), d.Growth())
+}
+
+// artifactPlatform returns the platform of the artifact as it is written
+// on the command-line, e.g. "linux/arm/7".
+func artifactPlatform(a *gox.Artifact) string {
+	p := gox.Platform{OS: a.OS, Arch: a.Arch, Variant: a.Variant}
+	return p.String()
+}
+
+// mainCompareManifest compares the sizes of the artifacts with those in
+// the manifest at path, printing the differences unless jsonOutput is set,
+// and fails if a binary grew by more than maxGrowth percent.
+func mainCompareManifest(path string, artifacts []gox.Artifact, maxGrowth float64, jsonOutput bool) int {
+	previous, err := gox.ReadManifest(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading manifest: %s\n", err)
+		return 1
+	}
+
+	deltas, err := gox.CompareManifest(previous, artifacts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error comparing manifest: %s\n", err)
+		return 1
+	}
+
+	if !jsonOutput {
+		printSizeDeltas(os.Stdout, path, deltas)
+	}
+
+	if maxGrowth > 0 {
+		if regressions := sizeRegressions(deltas, maxGrowth); len(regressions) > 0 {
+			fmt.Fprintf(os.Stderr, "\n%d binaries grew too much:\n", len(regressions))
+			for _, r := range regressions {
+				fmt.Fprintf(os.Stderr, "--> %s\n", r)
+			}
+			return 1
+		}
+	}
+
+	return 0
+}
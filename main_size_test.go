@@ -0,0 +1,37 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/authelia/gox/gox"
+)
+
+func TestSizeRegressions(t *testing.T) {
+	deltas := []gox.SizeDelta{
+		{
+			Artifact: gox.Artifact{ImportPath: "foo", OS: "linux", Arch: "arm", Variant: "7"},
+			OldSize:  1000,
+			Size:     1200,
+		},
+		{
+			Artifact: gox.Artifact{ImportPath: "foo", OS: "linux", Arch: "amd64"},
+			OldSize:  1000,
+			Size:     1050,
+		},
+		{
+			Artifact: gox.Artifact{ImportPath: "bar", OS: "linux", Arch: "amd64"},
+			OldSize:  2048,
+			Size:     1024,
+		},
+	}
+
+	expected := []string{"linux/arm/7: foo grew by +200 B (+20.0%), more than 10%"}
+	if actual := sizeRegressions(deltas, 10); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	if actual := formatDelta(&deltas[2]); actual != "-1.0 KiB (-50.0%)" {
+		t.Fatalf("bad: %s", actual)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/authelia/gox/gox"
+)
+
+// printSummary prints a table of the results of every build, sorted by
+// package and platform, followed by the totals. wall is the time taken by
+// the whole run.
+func printSummary(w io.Writer, results []*gox.Result, wall time.Duration) {
+	sorted := make([]*gox.Result, len(results))
+	copy(sorted, results)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i].Job, sorted[j].Job
+		if a.Package != b.Package {
+			return a.Package < b.Package
+		}
+
+		return a.Platform.String() < b.Platform.String()
+	})
+
+	var cpu time.Duration
+	var passed, failed, skipped int
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "\nPACKAGE\tPLATFORM\tSTATUS\tTIME\tSIZE\tCGO")
+	for _, r := range sorted {
+		status, elapsed, size, cgo := "ok", "-", "-", "-"
+		switch {
+		case r.Skip != "":
+			status = "skipped"
+			skipped++
+		case r.Err != nil:
+			status = "failed"
+			failed++
+		default:
+			passed++
+		}
+
+		if r.Skip == "" {
+			cpu += r.Elapsed
+			elapsed = r.Elapsed.Round(time.Millisecond).String()
+			cgo = fmt.Sprintf("%v", r.Job.Opts.Cgo)
+		}
+
+		if len(r.Artifacts) > 0 {
+			if info, err := os.Stat(r.Artifacts[0].Path); err == nil {
+				size = gox.FormatSize(info.Size())
+			}
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			r.Job.Package, r.Job.Platform.String(), status, elapsed, size, cgo)
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "\n%d passed, %d failed, %d skipped\n", passed, failed, skipped)
+	fmt.Fprintf(w, "CPU time: %s, wall time: %s", cpu.Round(time.Millisecond), wall.Round(time.Millisecond))
+	if wall > 0 {
+		fmt.Fprintf(w, ", effective parallelism: %.1fx", float64(cpu)/float64(wall))
+	}
+	fmt.Fprintln(w)
+}
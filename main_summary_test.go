@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/authelia/gox/gox"
+)
+
+func TestPrintSummary(t *testing.T) {
+	linux := gox.Platform{OS: "linux", Arch: "amd64"}
+	darwin := gox.Platform{OS: "darwin", Arch: "arm64"}
+	results := []*gox.Result{
+		{
+			Job:     &gox.Job{Package: "foo", Platform: linux, Opts: &gox.CompileOpts{}},
+			Elapsed: 2 * time.Second,
+			Err:     errors.New("bad build"),
+		},
+		{
+			Job:     &gox.Job{Package: "foo", Platform: darwin, Opts: &gox.CompileOpts{Cgo: true}},
+			Elapsed: time.Second,
+		},
+		{
+			Job:  &gox.Job{Package: "bar", Platform: linux, Opts: &gox.CompileOpts{}},
+			Skip: "canceled",
+		},
+	}
+
+	var out bytes.Buffer
+	printSummary(&out, results, 2*time.Second)
+
+	expected := `
+PACKAGE  PLATFORM      STATUS   TIME  SIZE  CGO
+bar      linux/amd64   skipped  -     -     -
+foo      darwin/arm64  ok       1s    -     true
+foo      linux/amd64   failed   2s    -     false
+
+1 passed, 1 failed, 1 skipped
+CPU time: 3s, wall time: 2s, effective parallelism: 1.5x
+`
+	if out.String() != expected {
+		t.Fatalf("bad:\n%s", strings.ReplaceAll(out.String(), " ", "."))
+	}
+}